@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// hookKillBuffer is the host hook run when a buffer is killed. Its first
+// argument is the name of the buffer.
+const hookKillBuffer = "kill-buffer"
+
+// bufferOptionPrefixes are the host options published for single buffers;
+// each is followed by the buffer name.
+var bufferOptionPrefixes = []string{diffRefinedOption, diffFoldsOption, diffFoldLabelsOption, diffGutterOption}
+
+// setBufferOption publishes the option prefix of bufferName, and remembers
+// to clear it when the buffer is killed.
+func (p *BufferDiffPlugin) setBufferOption(prefix, bufferName string, value interface{}) error {
+	p.mu.Lock()
+	if p.optionBuffers == nil {
+		p.optionBuffers = map[string]bool{}
+	}
+	p.optionBuffers[bufferName] = true
+	p.mu.Unlock()
+	p.watchKills()
+	return p.host.SetOption(prefix+bufferName, value)
+}
+
+// watchKills registers killBufferHook with the host, once.
+func (p *BufferDiffPlugin) watchKills() {
+	p.mu.Lock()
+	addHook := !p.killHooked
+	p.killHooked = true
+	p.mu.Unlock()
+	if addHook {
+		p.host.AddHook(hookKillBuffer, p.killBufferHook)
+	}
+}
+
+// clearBufferOptions unsets options of bufferName by setting them to nil,
+// which hosts take as removing them.
+func (p *BufferDiffPlugin) clearBufferOptions(bufferName string, prefixes ...string) {
+	for _, prefix := range prefixes {
+		if err := p.host.SetOption(prefix+bufferName, nil); err != nil {
+			fmt.Printf("[PLUGIN] Failed to clear %s%s: %v\n", prefix, bufferName, err)
+		}
+	}
+}
+
+// killBufferHook forgets what the plugin keeps for a killed buffer: its
+// options, the minor modes it enabled there, and its session, folds, watch,
+// gutter and synchronized scrolling. A buffer created later under the same name starts afresh.
+func (p *BufferDiffPlugin) killBufferHook(args ...interface{}) error {
+	if len(args) == 0 {
+		return nil
+	}
+	name, ok := args[0].(string)
+	if !ok {
+		return nil
+	}
+	p.execMu.Lock()
+	defer p.execMu.Unlock()
+
+	p.unwatchDiff(name)
+	p.mu.Lock()
+	published := p.optionBuffers[name]
+	delete(p.optionBuffers, name)
+	delete(p.gutters, name)
+	delete(p.scrollSyncs, name)
+	p.mu.Unlock()
+	for key := range p.minorModes {
+		if strings.HasPrefix(key, minorModeKey(name, "")) {
+			delete(p.minorModes, key)
+		}
+	}
+	delete(p.sessions, name)
+	delete(p.folds, name)
+
+	if published {
+		p.clearBufferOptions(name, bufferOptionPrefixes...)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKillBufferClearsOptions(t *testing.T) {
+	lines := numberedLines(60)
+	a := &mockBuffer{name: "a", content: strings.Join(lines, "\n")}
+	lines[29] = "changed line"
+	b := &mockBuffer{name: "b", content: strings.Join(lines, "\n")}
+	host := newMockHost(a, b)
+	host.options[diffHostFoldsOption] = true
+	plugin := &BufferDiffPlugin{host: host}
+
+	plugin.ExecuteCommand("buffer-diff", "a", "b")
+	name := "*Diff: a <-> b*"
+	for _, prefix := range []string{diffRefinedOption, diffFoldsOption, diffFoldLabelsOption} {
+		if _, ok := host.options[prefix+name]; !ok {
+			t.Errorf("Expected %s to be published", prefix+name)
+		}
+	}
+
+	host.TriggerHook(hookKillBuffer, "a")
+	if _, ok := host.options[diffFoldsOption+name]; !ok {
+		t.Error("Expected killing another buffer to keep the options")
+	}
+
+	host.TriggerHook(hookKillBuffer, name)
+	for option := range host.options {
+		if strings.HasSuffix(option, name) {
+			t.Errorf("Expected %s to be cleared", option)
+		}
+	}
+	if len(host.hooks[hookKillBuffer]) != 1 {
+		t.Errorf("Expected the hook to be added once, got %d", len(host.hooks[hookKillBuffer]))
+	}
+}
+
+func TestKillBufferThenRecreate(t *testing.T) {
+	a := &mockBuffer{name: "a", content: "one\ntwo"}
+	b := &mockBuffer{name: "b", content: "one\nTWO"}
+	host := newMockHost(a, b)
+	host.options["diff-history-size"] = 50
+	host.options["diff-history-file"] = filepath.Join(t.TempDir(), "diff-history.json")
+	plugin := &BufferDiffPlugin{host: host}
+	name := "*Diff: a <-> b*"
+
+	plugin.ExecuteCommand("buffer-diff", "a", "b")
+	plugin.ExecuteCommand("diff-watch-mode")
+	plugin.ExecuteCommand("diff-fold-toggle")
+	plugin.ExecuteCommand("buffer-diff-history")
+	host.killBuffer(name)
+	host.killBuffer(diffHistoryBufferName)
+
+	if plugin.sessions[name] != nil || plugin.folds[name] != nil || plugin.watchedDiff(name) {
+		t.Error("Expected the session, folds and watch of the killed buffer to be dropped")
+	}
+	for key := range plugin.minorModes {
+		if strings.HasPrefix(key, minorModeKey(name, "")) {
+			t.Errorf("Expected %q to be forgotten", key)
+		}
+	}
+
+	// The new buffer gets its modes turned on again.
+	plugin.ExecuteCommand("buffer-diff", "a", "b")
+	if !host.minorModes[name+" "+diffSessionMode] {
+		t.Errorf("Expected %s to be on in the new %s", diffSessionMode, name)
+	}
+	if err := plugin.ExecuteCommand("diff-session-next"); err == nil || err.Error() != "PLUGIN_MESSAGE:Difference 1 of 1" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	plugin.ExecuteCommand("buffer-diff-history")
+	if !host.minorModes[diffHistoryBufferName+" "+diffHistoryMode] {
+		t.Errorf("Expected %s to be on in the new %s", diffHistoryMode, diffHistoryBufferName)
+	}
+}
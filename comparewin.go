@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// compareRunes advances i in a and j in b while the text matches and
+// returns where it stopped. With ignoreWhitespace, whitespace on either side
+// is skipped.
+func compareRunes(a, b []rune, i, j int, ignoreWhitespace bool) (int, int) {
+	for {
+		if ignoreWhitespace {
+			i = skipWhitespace(a, i)
+			j = skipWhitespace(b, j)
+		}
+		if i >= len(a) || j >= len(b) || a[i] != b[j] {
+			return i, j
+		}
+		i++
+		j++
+	}
+}
+
+func skipWhitespace(text []rune, i int) int {
+	for i < len(text) && unicode.IsSpace(text[i]) {
+		i++
+	}
+	return i
+}
+
+// resyncRunes finds where a and b match again after the mismatch at i and j:
+// the starts of the first pair of lines the diff aligns. ok is false when no
+// line after the cursors matches.
+func resyncRunes(a, b []rune, i, j int, ignoreWhitespace bool) (int, int, bool) {
+	restA, restB := string(a[i:]), string(b[j:])
+	linesA, linesB := strings.Split(restA, "\n"), strings.Split(restB, "\n")
+	params := diffParams{algorithm: algorithmMyers, ignoreWhitespace: ignoreWhitespace}
+	for k, m := range params.match(linesA, linesB) {
+		if m >= 0 && (k > 0 || m > 0) {
+			return i + lineOffset(restA, k), j + lineOffset(restB, m), true
+		}
+	}
+	return i, j, false
+}
+
+// HandleCompareWindows compares the current buffer with otherBufferName
+// from the cursor of each, like Emacs compare-windows. Both cursors move to
+// the first mismatch. When they already are at a mismatch, they move past
+// it to where the text matches again, so repeating the command walks
+// through the differences. An empty buffer name compares with the buffer
+// used last time.
+func (p *BufferDiffPlugin) HandleCompareWindows(otherBufferName string) error {
+	if p.host == nil {
+		return fmt.Errorf("ERROR: host is nil")
+	}
+	current := p.host.GetCurrentBuffer()
+	if current == nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:No current buffer")
+	}
+	if otherBufferName == "" {
+		otherBufferName = p.compareWith[current.Name()]
+		if otherBufferName == "" {
+			return fmt.Errorf("PLUGIN_MESSAGE:No buffer to compare %s with", current.Name())
+		}
+	}
+	if otherBufferName == current.Name() {
+		return fmt.Errorf("PLUGIN_MESSAGE:Cannot compare %s with itself", otherBufferName)
+	}
+	other := p.host.FindBuffer(otherBufferName)
+	if other == nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:Buffer not found: %s", otherBufferName)
+	}
+	if p.compareWith == nil {
+		p.compareWith = map[string]string{}
+	}
+	p.compareWith[current.Name()] = otherBufferName
+
+	ignoreWhitespace := p.boolOption("compare-ignore-whitespace", false)
+	contentA, contentB := current.Content(), other.Content()
+	a, b := []rune(contentA), []rune(contentB)
+	startA, startB := min(current.CursorPosition(), len(a)), min(other.CursorPosition(), len(b))
+
+	i, j := compareRunes(a, b, startA, startB, ignoreWhitespace)
+	var message string
+	switch {
+	case i == len(a) && j == len(b):
+		message = fmt.Sprintf("%s and %s match to the end", current.Name(), otherBufferName)
+	case i > startA || j > startB:
+		message = fmt.Sprintf("Mismatch at line %d of %s and line %d of %s",
+			lineAt(contentA, i)+1, current.Name(), lineAt(contentB, j)+1, otherBufferName)
+	default:
+		var ok bool
+		i, j, ok = resyncRunes(a, b, i, j, ignoreWhitespace)
+		if !ok {
+			return fmt.Errorf("PLUGIN_MESSAGE:No matching text after the cursors")
+		}
+		message = fmt.Sprintf("Skipped a difference to line %d of %s and line %d of %s",
+			lineAt(contentA, i)+1, current.Name(), lineAt(contentB, j)+1, otherBufferName)
+	}
+
+	current.SetCursorPosition(i)
+	other.SetCursorPosition(j)
+	return fmt.Errorf("PLUGIN_MESSAGE:%s", message)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompareWindows(t *testing.T) {
+	a := &mockBuffer{name: "a", content: "alpha beta\ngamma delta\nsame\nend"}
+	b := &mockBuffer{name: "b", content: "alpha beta\ngamma DELTA\nsame\nend"}
+	host := newMockHost(a, b)
+	plugin := &BufferDiffPlugin{host: host}
+
+	if err := plugin.ExecuteCommand("compare-windows", ""); err == nil || err.Error() != "PLUGIN_MESSAGE:No buffer to compare a with" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if err := plugin.ExecuteCommand("compare-windows", "a"); err == nil || err.Error() != "PLUGIN_MESSAGE:Cannot compare a with itself" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+
+	err := plugin.ExecuteCommand("compare-windows", "b")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:Mismatch at line 2 of a and line 2 of b" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if a.cursor != strings.Index(a.content, "delta") || b.cursor != strings.Index(b.content, "DELTA") {
+		t.Errorf("Expected both cursors on the mismatch, got %d and %d", a.cursor, b.cursor)
+	}
+
+	// Repeating moves past the mismatch, then on to the next one.
+	err = plugin.ExecuteCommand("compare-windows", "")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:Skipped a difference to line 3 of a and line 3 of b" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if a.cursor != strings.Index(a.content, "same") || b.cursor != strings.Index(b.content, "same") {
+		t.Errorf("Expected both cursors on 'same', got %d and %d", a.cursor, b.cursor)
+	}
+	err = plugin.ExecuteCommand("compare-windows", "")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:a and b match to the end" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+}
+
+func TestCompareWindowsIgnoreWhitespace(t *testing.T) {
+	a := &mockBuffer{name: "a", content: "x  = 1\ny"}
+	b := &mockBuffer{name: "b", content: "x = 1\nz"}
+	host := newMockHost(a, b)
+	plugin := &BufferDiffPlugin{host: host}
+
+	err := plugin.ExecuteCommand("compare-windows", "b")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:Mismatch at line 1 of a and line 1 of b" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+
+	a.cursor, b.cursor = 0, 0
+	host.options["compare-ignore-whitespace"] = true
+	err = plugin.ExecuteCommand("compare-windows", "b")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:Mismatch at line 2 of a and line 2 of b" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if a.cursor != strings.Index(a.content, "y") || b.cursor != strings.Index(b.content, "z") {
+		t.Errorf("Expected both cursors on the last line, got %d and %d", a.cursor, b.cursor)
+	}
+
+	if err := plugin.ExecuteCommand("compare-windows", "b"); err == nil || err.Error() != "PLUGIN_MESSAGE:No matching text after the cursors" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// bufferLister is implemented by hosts that can name their open buffers.
+// It is not part of the SDK's HostInterface yet, so it is asserted at
+// runtime; RPCHostClient implements it over RPC.
+type bufferLister interface {
+	ListBuffers() []string
+}
+
+// maxRecentBuffers bounds the list of recently compared buffers.
+const maxRecentBuffers = 20
+
+// rememberCompared moves names, in order, to the front of the recently
+// compared list.
+func (p *BufferDiffPlugin) rememberCompared(names ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	recent := append([]string{}, names...)
+	for _, r := range p.recentBuffers {
+		if !slices.Contains(names, r) {
+			recent = append(recent, r)
+		}
+	}
+	p.recentBuffers = recent[:min(len(recent), maxRecentBuffers)]
+}
+
+// recentlyCompared returns the recently compared list. Completions are
+// served outside execMu, so they must not read the field directly.
+func (p *BufferDiffPlugin) recentlyCompared() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.recentBuffers
+}
+
+// bufferNames returns the names of the host's buffers. Hosts that cannot
+// list buffers, or whose listing fails or comes back empty, only offer the
+// buffers compared so far.
+func (p *BufferDiffPlugin) bufferNames() []string {
+	if lister, ok := p.host.(bufferLister); ok {
+		if names := lister.ListBuffers(); len(names) > 0 {
+			return names
+		}
+	}
+	var names []string
+	for _, name := range p.recentlyCompared() {
+		if p.host.FindBuffer(name) != nil {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// fuzzyMatch reports whether the runes of pattern appear in name in order,
+// ignoring case.
+func fuzzyMatch(pattern, name string) bool {
+	name = strings.ToLower(name)
+	for _, r := range strings.ToLower(pattern) {
+		i := strings.IndexRune(name, r)
+		if i < 0 {
+			return false
+		}
+		name = name[i+utf8.RuneLen(r):]
+	}
+	return true
+}
+
+// completeNames returns the names matching prefix: names starting with it
+// first, then names containing its characters in order. Within each group,
+// names in recent come first in that order, then the rest alphabetically.
+func completeNames(names []string, prefix string, recent []string) []string {
+	rank := map[string]int{}
+	for i, name := range recent {
+		rank[name] = i + 1
+	}
+	var prefixed, fuzzy []string
+	for _, name := range names {
+		switch {
+		case strings.HasPrefix(name, prefix):
+			prefixed = append(prefixed, name)
+		case fuzzyMatch(prefix, name):
+			fuzzy = append(fuzzy, name)
+		}
+	}
+	order := func(group []string) {
+		sort.Slice(group, func(i, j int) bool {
+			ri, rj := rank[group[i]], rank[group[j]]
+			switch {
+			case ri > 0 && rj > 0:
+				return ri < rj
+			case ri > 0 || rj > 0:
+				return ri > 0
+			}
+			return group[i] < group[j]
+		})
+	}
+	order(prefixed)
+	order(fuzzy)
+	return append(append([]string{}, prefixed...), fuzzy...)
+}
+
+// bufferCompletions completes a buffer name at a buffer-diff prompt.
+func (p *BufferDiffPlugin) bufferCompletions(prefix string) []string {
+	return completeNames(p.bufferNames(), prefix, p.recentlyCompared())
+}
+
+// promptCompleter is implemented by plugins that complete any prompt of a
+// command, not only the first. RPCServer prefers it over GetCompletions.
+type promptCompleter interface {
+	GetPromptCompletions(command string, prompt int, args []string, prefix string) []string
+}
+
+// Kinds of values an ArgPrompt asks for.
+const (
+	promptBuffer = iota + 1
+	promptDirectory
+	promptOption
+	promptOptionValue
+)
+
+// commandPrompts gives the kind of each ArgPrompt of the commands that take
+// arguments.
+var commandPrompts = map[string][]int{
+	"buffer-diff":               {promptBuffer, promptBuffer},
+	"buffer-diff-current":       {promptBuffer},
+	"patch-apply":               {promptBuffer, promptBuffer},
+	"patch-apply-partial":       {promptBuffer, promptBuffer},
+	"patch-apply-reverse":       {promptBuffer, promptBuffer},
+	"patch-apply-files":         {promptBuffer, promptDirectory},
+	"patch-apply-files-partial": {promptBuffer, promptDirectory},
+	"buffer-merge3":             {promptBuffer, promptBuffer, promptBuffer},
+	"diff-set-option":           {promptOption, promptOptionValue},
+	"compare-windows":           {promptBuffer},
+}
+
+// GetPromptCompletions completes the answer to ArgPrompt prompt of command.
+// args holds the answers to the prompts before it.
+func (p *BufferDiffPlugin) GetPromptCompletions(command string, prompt int, args []string, prefix string) []string {
+	if p.host == nil {
+		return []string{}
+	}
+	kinds := commandPrompts[command]
+	if prompt < 0 || prompt >= len(kinds) {
+		return []string{}
+	}
+	switch kinds[prompt] {
+	case promptBuffer:
+		return p.bufferCompletions(prefix)
+	case promptDirectory:
+		return pathCompletions(prefix, true)
+	case promptOption:
+		var names []string
+		for _, spec := range pluginOptions {
+			names = append(names, spec.name)
+		}
+		return completeNames(names, prefix, nil)
+	case promptOptionValue:
+		if len(args) == 0 {
+			return []string{}
+		}
+		spec, ok := findOption(args[0])
+		if !ok {
+			return []string{}
+		}
+		return completeNames(spec.optionValues(), prefix, nil)
+	}
+	return []string{}
+}
+
+// pathCompletions completes a file path. Directories end with a slash, and
+// with dirsOnly set nothing else is offered. Hidden entries are only offered
+// when the typed name starts with a dot. A leading ~/ stands for the home
+// directory and is kept in the results.
+func pathCompletions(prefix string, dirsOnly bool) []string {
+	dir, base := filepath.Split(prefix)
+	readDir := dir
+	if strings.HasPrefix(dir, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			readDir = filepath.Join(home, dir[2:])
+		}
+	}
+	if readDir == "" {
+		readDir = "."
+	}
+	entries, err := os.ReadDir(readDir)
+	if err != nil {
+		return []string{}
+	}
+
+	matches := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+		isDir := entry.IsDir()
+		if !isDir && entry.Type()&os.ModeSymlink != 0 {
+			if info, err := os.Stat(filepath.Join(readDir, name)); err == nil {
+				isDir = info.IsDir()
+			}
+		}
+		switch {
+		case isDir:
+			matches = append(matches, dir+name+"/")
+		case !dirsOnly:
+			matches = append(matches, dir+name)
+		}
+	}
+	return matches
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCompleteNames(t *testing.T) {
+	names := []string{"main.go", "README.md", "diff.go", "*scratch*", "render.go"}
+
+	tests := []struct {
+		prefix   string
+		recent   []string
+		expected []string
+	}{
+		{"", nil, []string{"*scratch*", "README.md", "diff.go", "main.go", "render.go"}},
+		{"", []string{"render.go", "main.go"}, []string{"render.go", "main.go", "*scratch*", "README.md", "diff.go"}},
+		{"d", nil, []string{"diff.go", "README.md", "render.go"}},
+		{"rgo", nil, []string{"render.go"}},
+		{"mgo", []string{"main.go"}, []string{"main.go"}},
+		{"xyz", nil, []string{}},
+	}
+	for _, test := range tests {
+		result := completeNames(names, test.prefix, test.recent)
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("completeNames(%q, %v): expected %q, got %q", test.prefix, test.recent, test.expected, result)
+		}
+	}
+}
+
+func TestBufferCompletions(t *testing.T) {
+	host := newMockHost(
+		&mockBuffer{name: "alpha"},
+		&mockBuffer{name: "beta"},
+		&mockBuffer{name: "gamma"},
+	)
+	plugin := &BufferDiffPlugin{host: host}
+
+	if result := plugin.GetCompletions("buffer-diff", ""); !reflect.DeepEqual(result, []string{"alpha", "beta", "gamma"}) {
+		t.Errorf("Unexpected completions: %q", result)
+	}
+
+	plugin.ExecuteCommand("buffer-diff", "gamma", "beta")
+	expected := []string{"gamma", "beta", "*Diff: gamma <-> beta*", "alpha"}
+	if result := plugin.GetCompletions("buffer-diff-current", ""); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %q, got %q", expected, result)
+	}
+	if result := plugin.GetCompletions("buffer-diff", "am"); !reflect.DeepEqual(result, []string{"gamma", "*Diff: gamma <-> beta*"}) {
+		t.Errorf("Unexpected fuzzy completions: %q", result)
+	}
+	if result := plugin.GetCompletions("diff-refresh", ""); len(result) != 0 {
+		t.Errorf("Expected no completions for diff-refresh, got %q", result)
+	}
+}
+
+func TestPromptCompletions(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "src"), 0755)
+	os.Mkdir(filepath.Join(dir, "scripts"), 0755)
+	os.Mkdir(filepath.Join(dir, ".git"), 0755)
+	os.WriteFile(filepath.Join(dir, "setup.py"), nil, 0644)
+
+	plugin := &BufferDiffPlugin{host: newMockHost(&mockBuffer{name: "fix.patch"})}
+
+	tests := []struct {
+		command  string
+		prompt   int
+		args     []string
+		prefix   string
+		expected []string
+	}{
+		{"patch-apply", 1, []string{"fix.patch"}, "fi", []string{"fix.patch"}},
+		{"patch-apply-files", 1, []string{"fix.patch"}, dir + "/s", []string{dir + "/scripts/", dir + "/src/"}},
+		{"patch-apply-files", 1, []string{"fix.patch"}, dir + "/.", []string{dir + "/.git/"}},
+		{"diff-set-option", 0, nil, "patch", []string{"patch-fuzz", "patch-max-offset"}},
+		{"diff-set-option", 1, []string{"diff-algorithm"}, "", []string{"myers", "patience"}},
+		{"diff-set-option", 1, []string{"diff-ignore-whitespace"}, "t", []string{"true"}},
+		{"diff-set-option", 1, []string{"diff-context"}, "", []string{}},
+		{"buffer-diff", 2, nil, "", []string{}},
+	}
+	for _, test := range tests {
+		result := plugin.GetPromptCompletions(test.command, test.prompt, test.args, test.prefix)
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("%s prompt %d %q: expected %q, got %q", test.command, test.prompt, test.prefix, test.expected, result)
+		}
+	}
+
+	files := pathCompletions(dir+"/s", false)
+	if !reflect.DeepEqual(files, []string{dir + "/scripts/", dir + "/setup.py", dir + "/src/"}) {
+		t.Errorf("Unexpected file completions: %q", files)
+	}
+}
+
+func TestDiffSetOption(t *testing.T) {
+	host := newMockHost()
+	plugin := &BufferDiffPlugin{host: host}
+
+	tests := []struct {
+		name, value string
+		expected    string
+	}{
+		{"diff-algorithm", "patience", "PLUGIN_MESSAGE:diff-algorithm set to patience"},
+		{"diff-context", "3", "PLUGIN_MESSAGE:diff-context set to 3"},
+		{"diff-ignore-whitespace", "true", "PLUGIN_MESSAGE:diff-ignore-whitespace set to true"},
+		{"diff-algorithm", "histogram", "PLUGIN_MESSAGE:diff-algorithm must be one of: myers, patience"},
+		{"diff-context", "some", "PLUGIN_MESSAGE:diff-context must be a number"},
+		{"diff-colour", "red", "PLUGIN_MESSAGE:Unknown option: diff-colour"},
+	}
+	for _, test := range tests {
+		err := plugin.ExecuteCommand("diff-set-option", test.name, test.value)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("Expected %q, got %v", test.expected, err)
+		}
+	}
+	if host.options["diff-context"] != 3 || host.options["diff-ignore-whitespace"] != true {
+		t.Errorf("Expected typed option values, got %v", host.options)
+	}
+}
+
+// unlistedHost is a host whose ListBuffers fails, as RPCHostClient does when
+// the host does not answer Host.ListBuffers.
+type unlistedHost struct {
+	*mockHost
+}
+
+func (h unlistedHost) ListBuffers() []string { return nil }
+
+func TestBufferCompletionsWithoutListing(t *testing.T) {
+	host := newMockHost(&mockBuffer{name: "alpha"}, &mockBuffer{name: "beta"}, &mockBuffer{name: "gamma"})
+	plugin := &BufferDiffPlugin{host: unlistedHost{host}}
+
+	if result := plugin.GetCompletions("buffer-diff", ""); len(result) != 0 {
+		t.Errorf("Expected no completions before any comparison, got %q", result)
+	}
+	plugin.ExecuteCommand("buffer-diff", "gamma", "beta")
+	if result := plugin.GetCompletions("buffer-diff", ""); !reflect.DeepEqual(result, []string{"gamma", "beta"}) {
+		t.Errorf("Expected the compared buffers, got %q", result)
+	}
+}
+
+func TestCompletionsDuringBufferDiff(t *testing.T) {
+	host := newMockHost(&mockBuffer{name: "alpha", content: "a"}, &mockBuffer{name: "beta", content: "b"})
+	plugin := &BufferDiffPlugin{host: unlistedHost{host}}
+	server := &RPCServer{Impl: plugin}
+	plugin.ExecuteCommand("buffer-diff", "alpha", "beta")
+	plugin.ExecuteCommand("buffer-diff", "beta", "alpha")
+
+	// net/rpc serves completions on their own goroutine while a command
+	// may be recording the compared buffers; run with -race.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			plugin.ExecuteCommand("buffer-diff", "alpha", "beta")
+			plugin.ExecuteCommand("buffer-diff", "beta", "alpha")
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		var result []string
+		server.GetCompletions(CompletionArgs{Command: "buffer-diff", Prefix: ""}, &result)
+		if len(result) != 2 {
+			t.Errorf("Expected 2 completions, got %q", result)
+		}
+	}
+	<-done
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	pluginsdk "github.com/TakahashiShuuhei/gmacs-plugin-sdk"
+)
+
+// mergeConflictMode is the minor mode that binds the conflict commands.
+const mergeConflictMode = "merge-conflict-mode"
+
+// conflictRefineBufferName is where merge-refine shows the differences
+// between the two sides of a conflict.
+const conflictRefineBufferName = "*Conflict Refine*"
+
+// conflict is one conflict block in a buffer, as buffer line indexes of its
+// markers. base is -1 for conflicts written without a base section.
+type conflict struct {
+	start  int // <<<<<<< line
+	base   int // ||||||| line
+	sep    int // ======= line
+	end    int // >>>>>>> line
+	labels [3]string
+}
+
+func (c conflict) mine(lines []string) []string {
+	if c.base >= 0 {
+		return lines[c.start+1 : c.base]
+	}
+	return lines[c.start+1 : c.sep]
+}
+
+func (c conflict) baseLines(lines []string) []string {
+	if c.base < 0 {
+		return nil
+	}
+	return lines[c.base+1 : c.sep]
+}
+
+func (c conflict) theirs(lines []string) []string {
+	return lines[c.sep+1 : c.end]
+}
+
+// parseConflicts finds the complete conflict blocks in lines. Incomplete
+// blocks are ignored.
+func parseConflicts(lines []string) []conflict {
+	var conflicts []conflict
+	for i := 0; i < len(lines); i++ {
+		if !isMarker(lines[i], markerMine) {
+			continue
+		}
+		c := conflict{start: i, base: -1, sep: -1, end: -1}
+		c.labels[0] = markerLabel(lines[i])
+		for j := i + 1; j < len(lines) && c.end < 0; j++ {
+			switch {
+			case isMarker(lines[j], markerMine):
+				// A new conflict starts before this one was closed.
+				j = len(lines)
+			case c.sep < 0 && c.base < 0 && isMarker(lines[j], markerBase):
+				c.base = j
+				c.labels[1] = markerLabel(lines[j])
+			case c.sep < 0 && lines[j] == markerSep:
+				c.sep = j
+			case c.sep >= 0 && isMarker(lines[j], markerTheirs):
+				c.end = j
+				c.labels[2] = markerLabel(lines[j])
+			}
+		}
+		if c.end < 0 {
+			continue
+		}
+		conflicts = append(conflicts, c)
+		i = c.end
+	}
+	return conflicts
+}
+
+func isMarker(line, marker string) bool {
+	return line == marker || strings.HasPrefix(line, marker+" ")
+}
+
+// markerLabel returns the text after a marker; all markers are seven
+// characters long.
+func markerLabel(line string) string {
+	return strings.TrimSpace(line[len(markerMine):])
+}
+
+// conflictAt returns the conflict containing line index.
+func conflictAt(conflicts []conflict, index int) (conflict, bool) {
+	for _, c := range conflicts {
+		if index >= c.start && index <= c.end {
+			return c, true
+		}
+	}
+	return conflict{}, false
+}
+
+// currentConflicts returns the current buffer, its lines, its conflicts and
+// the line under the cursor. A buffer found to hold conflicts, such as a file
+// left by git merge, gets merge-conflict-mode so the C-c ^ keys work there.
+func (p *BufferDiffPlugin) currentConflicts() (pluginsdk.BufferInterface, []string, []conflict, int, error) {
+	buffer := p.host.GetCurrentBuffer()
+	if buffer == nil {
+		return nil, nil, nil, 0, fmt.Errorf("PLUGIN_MESSAGE:No current buffer")
+	}
+	content := buffer.Content()
+	lines := strings.Split(content, "\n")
+	conflicts := parseConflicts(lines)
+	if len(conflicts) == 0 {
+		return nil, nil, nil, 0, fmt.Errorf("PLUGIN_MESSAGE:No conflicts in %s", buffer.Name())
+	}
+	p.enableMinorMode(buffer.Name(), mergeConflictMode)
+	return buffer, lines, conflicts, lineAt(content, buffer.CursorPosition()), nil
+}
+
+// HandleMergeConflictMode toggles merge-conflict-mode in the current buffer,
+// for buffers with conflict markers the plugin did not create.
+func (p *BufferDiffPlugin) HandleMergeConflictMode() error {
+	if p.host == nil {
+		return fmt.Errorf("ERROR: host is nil")
+	}
+	buffer := p.host.GetCurrentBuffer()
+	if buffer == nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:No current buffer")
+	}
+	name := buffer.Name()
+
+	if p.disableMinorMode(name, mergeConflictMode) {
+		return fmt.Errorf("PLUGIN_MESSAGE:%s disabled in %s", mergeConflictMode, name)
+	}
+	if !p.enableMinorMode(name, mergeConflictMode) {
+		return fmt.Errorf("PLUGIN_MESSAGE:Failed to enable %s", mergeConflictMode)
+	}
+	conflicts := parseConflicts(strings.Split(buffer.Content(), "\n"))
+	return fmt.Errorf("PLUGIN_MESSAGE:%s enabled in %s: %d conflicts", mergeConflictMode, name, len(conflicts))
+}
+
+// HandleMergeNextConflict moves the cursor to the next conflict.
+func (p *BufferDiffPlugin) HandleMergeNextConflict() error {
+	return p.gotoConflict(true)
+}
+
+// HandleMergePrevConflict moves the cursor to the previous conflict.
+func (p *BufferDiffPlugin) HandleMergePrevConflict() error {
+	return p.gotoConflict(false)
+}
+
+func (p *BufferDiffPlugin) gotoConflict(forward bool) error {
+	if p.host == nil {
+		return fmt.Errorf("ERROR: host is nil")
+	}
+	buffer, lines, conflicts, line, err := p.currentConflicts()
+	if err != nil {
+		return err
+	}
+
+	target := -1
+	for i, c := range conflicts {
+		if forward && c.start > line {
+			target = i
+			break
+		}
+		if !forward && c.start < line {
+			target = i
+		}
+	}
+	if target < 0 {
+		if forward {
+			return fmt.Errorf("PLUGIN_MESSAGE:No next conflict")
+		}
+		return fmt.Errorf("PLUGIN_MESSAGE:No previous conflict")
+	}
+
+	buffer.SetCursorPosition(lineOffset(strings.Join(lines, "\n"), conflicts[target].start))
+	return fmt.Errorf("PLUGIN_MESSAGE:Conflict %d of %d", target+1, len(conflicts))
+}
+
+// conflict resolutions accepted by resolveConflictAtPoint.
+const (
+	keepMine   = "mine"
+	keepTheirs = "theirs"
+	keepBase   = "base"
+	keepBoth   = "both"
+)
+
+// resolveConflictAtPoint replaces the conflict under the cursor with the
+// chosen side and leaves the cursor at its start.
+func (p *BufferDiffPlugin) resolveConflictAtPoint(keep string) error {
+	if p.host == nil {
+		return fmt.Errorf("ERROR: host is nil")
+	}
+	buffer, lines, conflicts, line, err := p.currentConflicts()
+	if err != nil {
+		return err
+	}
+	c, ok := conflictAt(conflicts, line)
+	if !ok {
+		return fmt.Errorf("PLUGIN_MESSAGE:No conflict at point")
+	}
+
+	var resolved []string
+	switch keep {
+	case keepMine:
+		resolved = c.mine(lines)
+	case keepTheirs:
+		resolved = c.theirs(lines)
+	case keepBase:
+		if c.base < 0 {
+			return fmt.Errorf("PLUGIN_MESSAGE:Conflict has no base section")
+		}
+		resolved = c.baseLines(lines)
+	case keepBoth:
+		resolved = append(append([]string(nil), c.mine(lines)...), c.theirs(lines)...)
+	}
+
+	replaceLines(buffer, lines, c.start, c.end-c.start+1, append([]string(nil), resolved...))
+	buffer.SetCursorPosition(lineOffset(buffer.Content(), c.start))
+
+	return fmt.Errorf("PLUGIN_MESSAGE:Kept %s, %d conflicts remaining", keep, len(conflicts)-1)
+}
+
+func (p *BufferDiffPlugin) HandleMergeKeepMine() error {
+	return p.resolveConflictAtPoint(keepMine)
+}
+
+func (p *BufferDiffPlugin) HandleMergeKeepTheirs() error {
+	return p.resolveConflictAtPoint(keepTheirs)
+}
+
+func (p *BufferDiffPlugin) HandleMergeKeepBase() error {
+	return p.resolveConflictAtPoint(keepBase)
+}
+
+func (p *BufferDiffPlugin) HandleMergeKeepBoth() error {
+	return p.resolveConflictAtPoint(keepBoth)
+}
+
+// HandleMergeRefine shows a diff between the two sides of the conflict at
+// point, so the actual differences stand out from what both sides share.
+func (p *BufferDiffPlugin) HandleMergeRefine() error {
+	if p.host == nil {
+		return fmt.Errorf("ERROR: host is nil")
+	}
+	_, lines, conflicts, line, err := p.currentConflicts()
+	if err != nil {
+		return err
+	}
+	c, ok := conflictAt(conflicts, line)
+	if !ok {
+		return fmt.Errorf("PLUGIN_MESSAGE:No conflict at point")
+	}
+
+	mine, theirs := c.mine(lines), c.theirs(lines)
+	listing := diffListing(mine, theirs, matchLinesMyers(mine, theirs))
+	refined := []string{
+		fmt.Sprintf("--- %s", conflictLabel(c.labels[0], "mine")),
+		fmt.Sprintf("+++ %s", conflictLabel(c.labels[2], "theirs")),
+		"",
+	}
+	changes := 0
+	for _, l := range listing {
+		refined = append(refined, string(l.op)+l.text)
+		if l.op != ' ' {
+			changes++
+		}
+	}
+
+	refineBuffer := p.host.FindBuffer(conflictRefineBufferName)
+	if refineBuffer == nil {
+		refineBuffer = p.host.CreateBuffer(conflictRefineBufferName)
+		if refineBuffer == nil {
+			return fmt.Errorf("PLUGIN_MESSAGE:Failed to create refine buffer")
+		}
+	}
+	refineBuffer.SetContent(strings.Join(refined, "\n"))
+	p.setDiffMode(conflictRefineBufferName, refineBuffer.Content())
+
+	if err := p.host.SwitchToBuffer(conflictRefineBufferName); err != nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:Failed to switch to refine buffer: %v", err)
+	}
+	return fmt.Errorf("PLUGIN_MESSAGE:Conflict sides differ in %d lines", changes)
+}
+
+func conflictLabel(label, fallback string) string {
+	if label == "" {
+		return fallback
+	}
+	return label
+}
+
+// minorModeKey is the key of modeName in bufferName in p.minorModes.
+func minorModeKey(bufferName, modeName string) string {
+	return bufferName + "\x00" + modeName
+}
+
+// enableMinorMode turns modeName on in bufferName. The host only offers a
+// toggle, so the plugin remembers which buffers it already enabled. It
+// reports whether the mode is on.
+func (p *BufferDiffPlugin) enableMinorMode(bufferName, modeName string) bool {
+	key := minorModeKey(bufferName, modeName)
+	if p.minorModes[key] {
+		return true
+	}
+	if err := p.host.ToggleMinorMode(bufferName, modeName); err != nil {
+		fmt.Printf("[PLUGIN] Failed to enable %s in '%s': %v\n", modeName, bufferName, err)
+		return false
+	}
+	if p.minorModes == nil {
+		p.minorModes = map[string]bool{}
+	}
+	p.minorModes[key] = true
+	p.watchKills()
+	return true
+}
+
+// disableMinorMode turns off a mode enableMinorMode turned on. It reports
+// whether the mode was on.
+func (p *BufferDiffPlugin) disableMinorMode(bufferName, modeName string) bool {
+	key := minorModeKey(bufferName, modeName)
+	if !p.minorModes[key] {
+		return false
+	}
+	if err := p.host.ToggleMinorMode(bufferName, modeName); err != nil {
+		fmt.Printf("[PLUGIN] Failed to disable %s in '%s': %v\n", modeName, bufferName, err)
+	}
+	delete(p.minorModes, key)
+	return true
+}
+
+// resolveTrivially returns the resolution of a conflict that only looks like
+// one: one side kept the base, so the other side's change wins, or both sides
+// made the same change. ok is false for genuine conflicts, including changes
+// to different lines of the same block. Conflicts without a base section only
+// resolve when both sides are identical.
+func resolveTrivially(c conflict, lines []string) (resolved []string, ok bool) {
+	mine, theirs := c.mine(lines), c.theirs(lines)
+	if equalLines(mine, theirs) {
+		return mine, true
+	}
+	if c.base < 0 {
+		return nil, false
+	}
+	base := c.baseLines(lines)
+	switch {
+	case equalLines(mine, base):
+		return theirs, true
+	case equalLines(theirs, base):
+		return mine, true
+	}
+	return nil, false
+}
+
+// HandleMergeResolveTrivial resolves every conflict in the current buffer
+// that resolveTrivially can settle and leaves the rest alone.
+func (p *BufferDiffPlugin) HandleMergeResolveTrivial() error {
+	if p.host == nil {
+		return fmt.Errorf("ERROR: host is nil")
+	}
+	buffer, lines, conflicts, _, err := p.currentConflicts()
+	if err != nil {
+		return err
+	}
+
+	resolvedCount := 0
+	// Work bottom-up so the line numbers of earlier conflicts stay valid.
+	for i := len(conflicts) - 1; i >= 0; i-- {
+		c := conflicts[i]
+		resolved, ok := resolveTrivially(c, lines)
+		if !ok {
+			continue
+		}
+		current := strings.Split(buffer.Content(), "\n")
+		replaceLines(buffer, current, c.start, c.end-c.start+1, append([]string(nil), resolved...))
+		resolvedCount++
+	}
+
+	return fmt.Errorf("PLUGIN_MESSAGE:Resolved %d conflicts automatically, %d remaining", resolvedCount, len(conflicts)-resolvedCount)
+}
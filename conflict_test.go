@@ -0,0 +1,202 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const conflictedText = `intro
+<<<<<<< mine
+x
+||||||| base
+b
+=======
+y
+>>>>>>> theirs
+middle
+<<<<<<< HEAD
+left
+=======
+right
+>>>>>>> feature
+outro`
+
+func TestParseConflicts(t *testing.T) {
+	lines := strings.Split(conflictedText, "\n")
+	conflicts := parseConflicts(lines)
+	if len(conflicts) != 2 {
+		t.Fatalf("Expected 2 conflicts, got %d", len(conflicts))
+	}
+
+	first := conflicts[0]
+	if first.start != 1 || first.base != 3 || first.sep != 5 || first.end != 7 {
+		t.Errorf("Unexpected markers for first conflict: %+v", first)
+	}
+	if strings.Join(first.baseLines(lines), ",") != "b" {
+		t.Errorf("Unexpected base: %v", first.baseLines(lines))
+	}
+
+	second := conflicts[1]
+	if second.base != -1 || second.labels != [3]string{"HEAD", "", "feature"} {
+		t.Errorf("Unexpected second conflict: %+v", second)
+	}
+	if strings.Join(second.mine(lines), ",") != "left" || strings.Join(second.theirs(lines), ",") != "right" {
+		t.Errorf("Unexpected sides: %v / %v", second.mine(lines), second.theirs(lines))
+	}
+}
+
+func TestMergeConflictCommands(t *testing.T) {
+	buffer := &mockBuffer{name: "merged", content: conflictedText}
+	plugin := &BufferDiffPlugin{host: newMockHost(buffer)}
+
+	if err := plugin.ExecuteCommand("merge-next-conflict"); err == nil || err.Error() != "PLUGIN_MESSAGE:Conflict 1 of 2" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if buffer.cursor != lineOffset(conflictedText, 1) {
+		t.Errorf("Expected cursor on line 1, got position %d", buffer.cursor)
+	}
+
+	if err := plugin.ExecuteCommand("merge-keep-base"); err == nil || err.Error() != "PLUGIN_MESSAGE:Kept base, 1 conflicts remaining" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+
+	if err := plugin.ExecuteCommand("merge-next-conflict"); err == nil || err.Error() != "PLUGIN_MESSAGE:Conflict 1 of 1" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if err := plugin.ExecuteCommand("merge-keep-base"); err == nil || err.Error() != "PLUGIN_MESSAGE:Conflict has no base section" {
+		t.Errorf("Expected refusal without base section, got %v", err)
+	}
+	if err := plugin.ExecuteCommand("merge-keep-both"); err == nil {
+		t.Error("Expected a status message")
+	}
+
+	if buffer.content != "intro\nb\nmiddle\nleft\nright\noutro" {
+		t.Errorf("Unexpected content: %q", buffer.content)
+	}
+	if err := plugin.ExecuteCommand("merge-prev-conflict"); err == nil || err.Error() != "PLUGIN_MESSAGE:No conflicts in merged" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+}
+
+func TestHandleMergeRefine(t *testing.T) {
+	buffer := &mockBuffer{name: "merged", content: conflictedText}
+	host := newMockHost(buffer)
+	plugin := &BufferDiffPlugin{host: host}
+
+	buffer.cursor = lineOffset(conflictedText, 11)
+	if err := plugin.ExecuteCommand("merge-refine"); err == nil || err.Error() != "PLUGIN_MESSAGE:Conflict sides differ in 2 lines" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	refine := host.FindBuffer(conflictRefineBufferName)
+	if refine == nil || refine.Content() != "--- HEAD\n+++ feature\n\n-left\n+right" {
+		t.Errorf("Unexpected refine buffer: %v", refine)
+	}
+}
+
+func TestHandleMergeResolveTrivial(t *testing.T) {
+	content := `start
+<<<<<<< mine
+old
+||||||| base
+old
+=======
+changed
+>>>>>>> theirs
+<<<<<<< mine
+x
+||||||| base
+b
+=======
+y
+>>>>>>> theirs
+<<<<<<< mine
+both
+=======
+both
+>>>>>>> theirs
+<<<<<<< mine
+mine only
+||||||| base
+kept
+=======
+kept
+>>>>>>> theirs
+<<<<<<< mine
+A
+b
+c
+||||||| base
+a
+b
+c
+=======
+a
+b
+C
+>>>>>>> theirs`
+	buffer := &mockBuffer{name: "merged", content: content}
+	plugin := &BufferDiffPlugin{host: newMockHost(buffer)}
+
+	err := plugin.ExecuteCommand("merge-resolve-trivial")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:Resolved 3 conflicts automatically, 2 remaining" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	// Changes to different lines of one block are still a conflict.
+	expected := "start\nchanged\n<<<<<<< mine\nx\n||||||| base\nb\n=======\ny\n>>>>>>> theirs\nboth\nmine only\n" +
+		"<<<<<<< mine\nA\nb\nc\n||||||| base\na\nb\nc\n=======\na\nb\nC\n>>>>>>> theirs"
+	if buffer.content != expected {
+		t.Errorf("Expected %q, got %q", expected, buffer.content)
+	}
+}
+
+func TestMergeConflictKeyBindings(t *testing.T) {
+	plugin := &BufferDiffPlugin{}
+	commands := map[string]bool{}
+	for _, cmd := range plugin.GetCommands() {
+		commands[cmd.Name] = true
+	}
+	for _, binding := range plugin.GetKeyBindings() {
+		if !commands[binding.Command] {
+			t.Errorf("Key %s is bound to unknown command %s", binding.Sequence, binding.Command)
+		}
+	}
+}
+
+func TestMergeConflictModeInForeignBuffer(t *testing.T) {
+	// A file left with conflict markers by git merge, opened normally.
+	buffer := &mockBuffer{name: "main.go", content: conflictedText, filename: "main.go"}
+	host := newMockHost(buffer)
+	plugin := &BufferDiffPlugin{host: host}
+
+	err := plugin.ExecuteCommand("merge-conflict-mode")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:merge-conflict-mode enabled in main.go: 2 conflicts" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if !host.minorModes["main.go "+mergeConflictMode] {
+		t.Error("Expected merge-conflict-mode to be on in main.go")
+	}
+
+	// The C-c ^ keys now reach the conflict commands.
+	if err := plugin.ExecuteCommand("merge-next-conflict"); err == nil || err.Error() != "PLUGIN_MESSAGE:Conflict 1 of 2" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if !host.minorModes["main.go "+mergeConflictMode] {
+		t.Error("Expected merge-conflict-mode to stay on")
+	}
+
+	err = plugin.ExecuteCommand("merge-conflict-mode")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:merge-conflict-mode disabled in main.go" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if host.minorModes["main.go "+mergeConflictMode] {
+		t.Error("Expected merge-conflict-mode to be off")
+	}
+
+	// Running a conflict command from M-x turns the mode back on.
+	if err := plugin.ExecuteCommand("merge-next-conflict"); err == nil || err.Error() != "PLUGIN_MESSAGE:Conflict 2 of 2" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if !host.minorModes["main.go "+mergeConflictMode] {
+		t.Error("Expected a conflict command to enable merge-conflict-mode")
+	}
+}
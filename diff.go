@@ -0,0 +1,240 @@
+package main
+
+import "sort"
+
+// matchLinesMyers returns, for every line of a, the index of the line of b it
+// is matched with in a shortest edit script, or -1 when the line is deleted.
+// It uses Myers' O(ND) algorithm after stripping the common prefix and suffix.
+func matchLinesMyers(a, b []string) []int {
+	matches := make([]int, len(a))
+	for i := range matches {
+		matches[i] = -1
+	}
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		matches[prefix] = prefix
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		matches[len(a)-1-suffix] = len(b) - 1 - suffix
+		suffix++
+	}
+
+	midA := a[prefix : len(a)-suffix]
+	midB := b[prefix : len(b)-suffix]
+	for _, m := range myersMatches(midA, midB) {
+		matches[prefix+m[0]] = prefix + m[1]
+	}
+	return matches
+}
+
+// myersMatches returns the matched index pairs of a shortest edit script
+// between a and b, in increasing order.
+func myersMatches(a, b []string) [][2]int {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return nil
+	}
+
+	offset := n + m
+	v := make([]int, 2*offset+2)
+	// trace[d] holds v[-d..d] as it was before step d.
+	var trace [][]int
+
+	x, y := 0, 0
+search:
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y = x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	var matches [][2]int
+	for d := len(trace) - 1; d >= 0; d-- {
+		prev := trace[d]
+		at := func(k int) int { return prev[k+d] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := 0
+		if d > 0 {
+			prevX = at(prevK)
+		}
+		prevY := prevX - prevK
+		if d == 0 {
+			prevX, prevY = 0, 0
+		}
+		for x > prevX && y > prevY {
+			x--
+			y--
+			matches = append(matches, [2]int{x, y})
+		}
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+		matches[i], matches[j] = matches[j], matches[i]
+	}
+	return matches
+}
+
+// diffListing returns the full listing that turns a into b: every line of
+// both sides, marked ' ', '-' or '+'. Deletions come before insertions
+// within a change.
+func diffListing(a, b []string, matches []int) []patchLine {
+	var listing []patchLine
+	j := 0
+	for i, line := range a {
+		if matches[i] < 0 {
+			listing = append(listing, patchLine{op: '-', text: line, bufLine: -1})
+			continue
+		}
+		for ; j < matches[i]; j++ {
+			listing = append(listing, patchLine{op: '+', text: b[j], bufLine: -1})
+		}
+		listing = append(listing, patchLine{op: ' ', text: line, bufLine: -1})
+		j++
+	}
+	for ; j < len(b); j++ {
+		listing = append(listing, patchLine{op: '+', text: b[j], bufLine: -1})
+	}
+	return sortChanges(listing)
+}
+
+// sortChanges moves the '-' lines of every change ahead of its '+' lines.
+func sortChanges(listing []patchLine) []patchLine {
+	sorted := make([]patchLine, 0, len(listing))
+	for i := 0; i < len(listing); {
+		if listing[i].op == ' ' {
+			sorted = append(sorted, listing[i])
+			i++
+			continue
+		}
+		end := i
+		for end < len(listing) && listing[end].op != ' ' {
+			end++
+		}
+		for _, l := range listing[i:end] {
+			if l.op == '-' {
+				sorted = append(sorted, l)
+			}
+		}
+		for _, l := range listing[i:end] {
+			if l.op == '+' {
+				sorted = append(sorted, l)
+			}
+		}
+		i = end
+	}
+	return sorted
+}
+
+// matchLinesPatience is matchLinesMyers with patience diff: lines that occur
+// exactly once on each side anchor the alignment, and only the gaps between
+// anchors are diffed with Myers. It keeps moved blocks and repeated lines
+// such as braces from pairing up with unrelated code.
+func matchLinesPatience(a, b []string) []int {
+	matches := make([]int, len(a))
+	for i := range matches {
+		matches[i] = -1
+	}
+	patienceMatches(a, b, 0, len(a), 0, len(b), matches)
+	return matches
+}
+
+func patienceMatches(a, b []string, aLo, aHi, bLo, bHi int, matches []int) {
+	for aLo < aHi && bLo < bHi && a[aLo] == b[bLo] {
+		matches[aLo] = bLo
+		aLo, bLo = aLo+1, bLo+1
+	}
+	for aLo < aHi && bLo < bHi && a[aHi-1] == b[bHi-1] {
+		aHi, bHi = aHi-1, bHi-1
+		matches[aHi] = bHi
+	}
+	if aLo == aHi || bLo == bHi {
+		return
+	}
+
+	anchors := uniqueCommonLines(a[aLo:aHi], b[bLo:bHi])
+	if len(anchors) == 0 {
+		for _, m := range myersMatches(a[aLo:aHi], b[bLo:bHi]) {
+			matches[aLo+m[0]] = bLo + m[1]
+		}
+		return
+	}
+
+	prevA, prevB := aLo, bLo
+	for _, anchor := range anchors {
+		i, j := aLo+anchor[0], bLo+anchor[1]
+		patienceMatches(a, b, prevA, i, prevB, j, matches)
+		matches[i] = j
+		prevA, prevB = i+1, j+1
+	}
+	patienceMatches(a, b, prevA, aHi, prevB, bHi, matches)
+}
+
+// uniqueCommonLines returns the longest increasing sequence of index pairs
+// of lines that occur exactly once in both a and b.
+func uniqueCommonLines(a, b []string) [][2]int {
+	countA := map[string]int{}
+	for _, line := range a {
+		countA[line]++
+	}
+	indexB := map[string]int{}
+	countB := map[string]int{}
+	for j, line := range b {
+		countB[line]++
+		indexB[line] = j
+	}
+	var pairs [][2]int
+	for i, line := range a {
+		if countA[line] == 1 && countB[line] == 1 {
+			pairs = append(pairs, [2]int{i, indexB[line]})
+		}
+	}
+
+	// Patience sorting: the pairs are in a order, find the longest run that
+	// is increasing in b as well.
+	var tops []int // index into pairs of the top card of each pile
+	prev := make([]int, len(pairs))
+	for k, pair := range pairs {
+		pile := sort.Search(len(tops), func(n int) bool { return pairs[tops[n]][1] > pair[1] })
+		prev[k] = -1
+		if pile > 0 {
+			prev[k] = tops[pile-1]
+		}
+		if pile == len(tops) {
+			tops = append(tops, k)
+		} else {
+			tops[pile] = k
+		}
+	}
+	if len(tops) == 0 {
+		return nil
+	}
+	lis := make([][2]int, len(tops))
+	for k, n := tops[len(tops)-1], len(tops)-1; k >= 0; k, n = prev[k], n-1 {
+		lis[n] = pairs[k]
+	}
+	return lis
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func formatListing(listing []patchLine) string {
+	var lines []string
+	for _, l := range listing {
+		lines = append(lines, string(l.op)+l.text)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestDiffListing(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected string
+	}{
+		{"a b c", "a b c", " a\n b\n c"},
+		{"a b c", "a x c", " a\n-b\n+x\n c"},
+		{"a b c d", "a c d e", " a\n-b\n c\n d\n+e"},
+		{"x a b", "a b y", "-x\n a\n b\n+y"},
+		{"a b c a b b a", "c b a b a c", "-a\n-b\n c\n+b\n a\n b\n-b\n a\n+c"},
+		{"", "a", "-\n+a"},
+	}
+	for _, tt := range tests {
+		a, b := strings.Fields(tt.a), strings.Fields(tt.b)
+		if tt.a == "" {
+			a = []string{""}
+		}
+		got := formatListing(diffListing(a, b, matchLinesMyers(a, b)))
+		if got != tt.expected {
+			t.Errorf("diff(%q, %q): expected %q, got %q", tt.a, tt.b, tt.expected, got)
+		}
+	}
+}
+
+func TestMatchLinesMyersIsMinimal(t *testing.T) {
+	a := strings.Fields("a b c a b b a")
+	b := strings.Fields("c b a b a c")
+	matches := matchLinesMyers(a, b)
+
+	kept := 0
+	last := -1
+	for _, m := range matches {
+		if m < 0 {
+			continue
+		}
+		if m <= last {
+			t.Fatalf("Matches are not increasing: %v", matches)
+		}
+		last = m
+		kept++
+	}
+	// The longest common subsequence of the classic Myers example has 4 lines.
+	if kept != 4 {
+		t.Errorf("Expected 4 matched lines, got %d (%v)", kept, matches)
+	}
+}
+
+func TestMatchLinesPatience(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected []int
+	}{
+		{"a b c", "a x c", []int{0, -1, 2}},
+		{"x a b", "a b y", []int{-1, 0, 1}},
+		// Unique lines anchor the alignment even when that leaves repeated
+		// lines unmatched.
+		{"u k k k v", "v k k k u", []int{-1, -1, -1, -1, 0}},
+		{"a b { } c", "{ } a b { } c", []int{2, 3, 4, 5, 6}},
+	}
+	for _, tt := range tests {
+		got := matchLinesPatience(strings.Fields(tt.a), strings.Fields(tt.b))
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("patience(%q, %q): expected %v, got %v", tt.a, tt.b, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	pluginsdk "github.com/TakahashiShuuhei/gmacs-plugin-sdk"
+)
+
+// Buffer positions are rune offsets into the buffer content.
+
+// lineOffset returns the position of the first character of line index.
+// Indexes past the last line return the end of the content.
+func lineOffset(content string, index int) int {
+	pos := 0
+	for line := 0; line < index; line++ {
+		nl := strings.IndexByte(content, '\n')
+		if nl < 0 {
+			return pos + utf8.RuneCountInString(content)
+		}
+		pos += utf8.RuneCountInString(content[:nl]) + 1
+		content = content[nl+1:]
+	}
+	return pos
+}
+
+// lineAt returns the line index containing position pos.
+func lineAt(content string, pos int) int {
+	line := 0
+	for i, r := range []rune(content) {
+		if i >= pos {
+			break
+		}
+		if r == '\n' {
+			line++
+		}
+	}
+	return line
+}
+
+// replaceLines replaces count lines of buffer starting at line index with
+// repl, touching only that range so the host's undo records a single edit.
+// lines must be the buffer content split on newlines.
+func replaceLines(buffer pluginsdk.BufferInterface, lines []string, index, count int, repl []string) {
+	content := strings.Join(lines, "\n")
+	text := strings.Join(repl, "\n")
+
+	var start, end int
+	switch {
+	case index+count < len(lines):
+		// Replace whole lines including their newlines.
+		start = lineOffset(content, index)
+		end = lineOffset(content, index+count)
+		if len(repl) > 0 {
+			text += "\n"
+		}
+	case index >= len(lines):
+		// Append after the last line.
+		start = utf8.RuneCountInString(content)
+		end = start
+		if len(repl) > 0 {
+			text = "\n" + text
+		}
+	case index > 0:
+		// The range runs to the end of the buffer: take the newline before it.
+		start = lineOffset(content, index) - 1
+		end = utf8.RuneCountInString(content)
+		if len(repl) > 0 {
+			text = "\n" + text
+		}
+	default:
+		start, end = 0, utf8.RuneCountInString(content)
+	}
+
+	if end > start {
+		buffer.DeleteRange(start, end)
+	}
+	if text != "" {
+		buffer.InsertAt(start, text)
+	}
+}
+
+// hunkSpan returns the first and last buffer line of a parsed hunk.
+func hunkSpan(hunk *patchHunk) (int, int) {
+	first := hunk.headerLine
+	if first < 0 && len(hunk.lines) > 0 {
+		first = hunk.lines[0].bufLine
+	}
+	last := first
+	if len(hunk.lines) > 0 {
+		last = hunk.lines[len(hunk.lines)-1].bufLine
+	}
+	return first, last
+}
+
+// hunkAtLine finds the hunk covering buffer line index.
+func hunkAtLine(files []*filePatch, index int) (*filePatch, *patchHunk, int) {
+	for _, file := range files {
+		for i, hunk := range file.hunks {
+			first, last := hunkSpan(hunk)
+			if index >= first && index <= last {
+				return file, hunk, i + 1
+			}
+		}
+	}
+	return nil, nil, 0
+}
+
+// currentDiffHunk parses the current buffer as a diff and returns the hunk
+// under the cursor.
+func (p *BufferDiffPlugin) currentDiffHunk() (*filePatch, *patchHunk, int, error) {
+	diffBuffer := p.host.GetCurrentBuffer()
+	if diffBuffer == nil {
+		return nil, nil, 0, fmt.Errorf("PLUGIN_MESSAGE:No current buffer")
+	}
+	files, err := parsePatch(diffBuffer.Content())
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("PLUGIN_MESSAGE:Invalid diff in %s: %v", diffBuffer.Name(), err)
+	}
+	line := lineAt(diffBuffer.Content(), diffBuffer.CursorPosition())
+	file, hunk, index := hunkAtLine(files, line)
+	if hunk == nil {
+		return nil, nil, 0, fmt.Errorf("PLUGIN_MESSAGE:No hunk at point")
+	}
+	return file, hunk, index, nil
+}
+
+// applyHunkToBuffer applies a single hunk to target, searching for it like
+// patch-apply does. Only the changed lines are rewritten.
+func (p *BufferDiffPlugin) applyHunkToBuffer(target pluginsdk.BufferInterface, hunk *patchHunk) (hunkResult, error) {
+	lines := strings.Split(target.Content(), "\n")
+	pos, _, _, fuzz, ok := locateHunk(lines, hunk, hunk.oldIndex(), p.patchApplyOptions())
+	if !ok {
+		mismatch := matchLines(lines, hunk.oldIndex(), hunk.oldLines())
+		return hunkResult{}, fmt.Errorf("%s", mismatchReason(lines, mismatch))
+	}
+
+	// Context lines stay untouched, even when fuzz let them differ.
+	leading, trailing := contextEdges(hunk.lines)
+	var removed, added []string
+	for _, l := range hunk.lines[leading : len(hunk.lines)-trailing] {
+		if l.op != '+' {
+			removed = append(removed, l.text)
+		}
+		if l.op != '-' {
+			added = append(added, l.text)
+		}
+	}
+	replaceLines(target, lines, pos+leading, len(removed), added)
+	return hunkResult{applied: true, line: pos + leading + 1, offset: pos - hunk.oldIndex(), fuzz: fuzz}, nil
+}
+
+// copyHunkAtPoint makes one side of the hunk under the cursor match the
+// other. With toOld set the old buffer (A) receives the new side (B's
+// version); otherwise B receives A's version.
+func (p *BufferDiffPlugin) copyHunkAtPoint(toOld bool) error {
+	if p.host == nil {
+		return fmt.Errorf("ERROR: host is nil")
+	}
+
+	file, hunk, index, err := p.currentDiffHunk()
+	if err != nil {
+		return err
+	}
+
+	targetName := file.newName
+	if toOld {
+		targetName = file.oldName
+	} else {
+		hunk = reversePatch(&filePatch{hunks: []*patchHunk{hunk}}).hunks[0]
+	}
+
+	target := p.host.FindBuffer(targetName)
+	if target == nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:Buffer not found: %s", targetName)
+	}
+	result, err := p.applyHunkToBuffer(target, hunk)
+	if err != nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:Hunk %d does not match %s: %v", index, targetName, err)
+	}
+	return fmt.Errorf("PLUGIN_MESSAGE:Hunk %d copied into %s at line %d", index, targetName, result.line)
+}
+
+// HandleDiffHunkCopyToA copies B's version of the hunk at point into A.
+func (p *BufferDiffPlugin) HandleDiffHunkCopyToA() error {
+	return p.copyHunkAtPoint(true)
+}
+
+// HandleDiffHunkCopyToB copies A's version of the hunk at point into B. It
+// also serves diff-hunk-revert, since reverting the hunk in B leaves A's
+// version there.
+func (p *BufferDiffPlugin) HandleDiffHunkCopyToB() error {
+	return p.copyHunkAtPoint(false)
+}
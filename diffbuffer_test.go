@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLineOffsetAndLineAt(t *testing.T) {
+	content := "héllo\nwörld\n\nend"
+
+	offsets := []int{0, 6, 12, 13, 16}
+	for line, expected := range offsets {
+		if got := lineOffset(content, line); got != expected {
+			t.Errorf("lineOffset(%d): expected %d, got %d", line, expected, got)
+		}
+	}
+	for line, pos := range offsets[:4] {
+		if got := lineAt(content, pos); got != line {
+			t.Errorf("lineAt(%d): expected %d, got %d", pos, line, got)
+		}
+	}
+}
+
+func TestReplaceLines(t *testing.T) {
+	tests := []struct {
+		content      string
+		index, count int
+		repl         []string
+		expected     string
+	}{
+		{"a\nb\nc", 1, 1, []string{"B1", "B2"}, "a\nB1\nB2\nc"},
+		{"a\nb\nc", 1, 1, nil, "a\nc"},
+		{"a\nb\nc", 2, 1, []string{"C"}, "a\nb\nC"},
+		{"a\nb\nc", 1, 2, nil, "a"},
+		{"a\nb\nc", 1, 0, []string{"x"}, "a\nx\nb\nc"},
+		{"a", 0, 1, []string{"z"}, "z"},
+		{"a\nb", 2, 0, []string{"c", "d"}, "a\nb\nc\nd"},
+	}
+	for _, tt := range tests {
+		buffer := &mockBuffer{name: "b", content: tt.content}
+		replaceLines(buffer, strings.Split(tt.content, "\n"), tt.index, tt.count, tt.repl)
+		if buffer.content != tt.expected {
+			t.Errorf("replaceLines(%q, %d, %d, %v): expected %q, got %q", tt.content, tt.index, tt.count, tt.repl, tt.expected, buffer.content)
+		}
+	}
+}
+
+func TestDiffHunkCopy(t *testing.T) {
+	a := &mockBuffer{name: "a", content: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12"}
+	b := &mockBuffer{name: "b", content: "1\ntwo\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve"}
+	host := newMockHost(a, b)
+	plugin := &BufferDiffPlugin{host: host}
+
+	plugin.ExecuteCommand("buffer-diff", "a", "b")
+	diff := host.buffers["*Diff: a <-> b*"]
+
+	// Cursor on "+twelve", the last line of the second hunk.
+	diff.cursor = strings.Index(diff.content, "+twelve")
+	err := plugin.ExecuteCommand("diff-hunk-copy-to-a")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:Hunk 2 copied into a at line 12" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if a.content != "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve" {
+		t.Errorf("Unexpected content of a: %q", a.content)
+	}
+
+	diff.cursor = strings.Index(diff.content, "+two")
+	err = plugin.ExecuteCommand("diff-hunk-revert")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:Hunk 1 copied into b at line 2" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if b.content != "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve" {
+		t.Errorf("Unexpected content of b: %q", b.content)
+	}
+
+	diff.cursor = 0
+	if err := plugin.ExecuteCommand("diff-hunk-copy-to-b"); err == nil || err.Error() != "PLUGIN_MESSAGE:No hunk at point" {
+		t.Errorf("Expected no hunk at point, got %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// editedHunk is a hunk located without trusting the counts in its header,
+// so it survives hand edits that add or drop body lines.
+type editedHunk struct {
+	header int // buffer line of the @@ header
+	end    int // first buffer line after the body
+	hunk   *patchHunk
+}
+
+// scanEditedHunks finds every @@ hunk in lines. A body runs until the next
+// hunk or file header or the first line that cannot be part of a hunk;
+// trailing empty lines are not counted. The returned hunks keep the positions
+// given by their headers, with counts recomputed from their bodies; a start
+// is adjusted when its range becomes empty or stops being empty, since
+// unified diff gives the line before an empty range.
+func scanEditedHunks(lines []string) ([]editedHunk, error) {
+	var hunks []editedHunk
+	for i := 0; i < len(lines); i++ {
+		if !strings.HasPrefix(lines[i], "@@ ") {
+			continue
+		}
+		hunk, err := parseHunkHeader(lines[i])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		hunk.headerLine = i
+		oldIndex, newIndex := hunk.oldIndex(), hunk.newIndex()
+		hunk.oldCount, hunk.newCount = 0, 0
+
+		end := i + 1
+		for end < len(lines) && isHunkBodyLine(lines, end) {
+			end++
+		}
+		for end > i+1 && lines[end-1] == "" {
+			end--
+		}
+		for j := i + 1; j < end; j++ {
+			line := lines[j]
+			if strings.HasPrefix(line, "\\") {
+				continue
+			}
+			op, text := byte(' '), ""
+			if line != "" {
+				op, text = line[0], line[1:]
+			}
+			hunk.lines = append(hunk.lines, patchLine{op: op, text: text, bufLine: j})
+			if op != '+' {
+				hunk.oldCount++
+			}
+			if op != '-' {
+				hunk.newCount++
+			}
+		}
+		hunk.oldStart, hunk.newStart = oldIndex+1, newIndex+1
+		if hunk.oldCount == 0 {
+			hunk.oldStart = oldIndex
+		}
+		if hunk.newCount == 0 {
+			hunk.newStart = newIndex
+		}
+		hunks = append(hunks, editedHunk{header: i, end: end, hunk: hunk})
+		i = end - 1
+	}
+	return hunks, nil
+}
+
+func isHunkBodyLine(lines []string, i int) bool {
+	line := lines[i]
+	if line == "" {
+		return true
+	}
+	if strings.HasPrefix(line, "@@ ") || strings.HasPrefix(line, "diff --git ") || isFileHeader(lines, i) {
+		return false
+	}
+	return strings.ContainsRune(" -+\\", rune(line[0]))
+}
+
+// recountHunks fixes the counts of every hunk and shifts the new-side start
+// lines by the size changes of the hunks before them in the same file.
+// It returns the buffer lines whose headers changed, with their new text.
+func recountHunks(lines []string) (map[int]string, error) {
+	hunks, err := scanEditedHunks(lines)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := map[int]string{}
+	delta := 0
+	for i, h := range hunks {
+		if i > 0 && startsNewFile(lines, hunks[i-1].end, h.header) {
+			delta = 0
+		}
+		hunk := h.hunk
+		hunk.newStart = hunk.oldIndex() + delta + 1
+		if hunk.newCount == 0 {
+			hunk.newStart--
+		}
+		delta += hunk.newCount - hunk.oldCount
+		if header := hunk.header(); header != lines[h.header] {
+			changed[h.header] = header
+		}
+	}
+	return changed, nil
+}
+
+// startsNewFile reports whether a file header sits between two hunks.
+func startsNewFile(lines []string, from, to int) bool {
+	for i := from; i < to; i++ {
+		if strings.HasPrefix(lines[i], "diff --git ") || isFileHeader(lines, i) {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleDiffRecountHunks rewrites the @@ headers of the current diff buffer
+// to match the hunk bodies after hand edits.
+func (p *BufferDiffPlugin) HandleDiffRecountHunks() error {
+	if p.host == nil {
+		return fmt.Errorf("ERROR: host is nil")
+	}
+
+	diffBuffer := p.host.GetCurrentBuffer()
+	if diffBuffer == nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:No current buffer")
+	}
+
+	lines := strings.Split(diffBuffer.Content(), "\n")
+	changed, err := recountHunks(lines)
+	if err != nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:Invalid diff in %s: %v", diffBuffer.Name(), err)
+	}
+	for index, header := range changed {
+		replaceLines(diffBuffer, lines, index, 1, []string{header})
+		lines[index] = header
+	}
+	return fmt.Errorf("PLUGIN_MESSAGE:Recounted hunks: %d headers updated", len(changed))
+}
+
+// HandleDiffSplitHunk splits the hunk at point in two. The context line under
+// the cursor becomes the first line of the second hunk.
+func (p *BufferDiffPlugin) HandleDiffSplitHunk() error {
+	if p.host == nil {
+		return fmt.Errorf("ERROR: host is nil")
+	}
+
+	diffBuffer := p.host.GetCurrentBuffer()
+	if diffBuffer == nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:No current buffer")
+	}
+
+	content := diffBuffer.Content()
+	lines := strings.Split(content, "\n")
+	hunks, err := scanEditedHunks(lines)
+	if err != nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:Invalid diff in %s: %v", diffBuffer.Name(), err)
+	}
+
+	cursorLine := lineAt(content, diffBuffer.CursorPosition())
+	for _, h := range hunks {
+		if cursorLine <= h.header || cursorLine >= h.end {
+			continue
+		}
+		first, second, err := splitHunk(h.hunk, cursorLine)
+		if err != nil {
+			return fmt.Errorf("PLUGIN_MESSAGE:%v", err)
+		}
+		// Rewrite the header first; it sits above the cursor, so the
+		// insertion point keeps its line number.
+		replaceLines(diffBuffer, lines, h.header, 1, []string{first.header()})
+		lines[h.header] = first.header()
+		replaceLines(diffBuffer, lines, cursorLine, 0, []string{second.header()})
+		return fmt.Errorf("PLUGIN_MESSAGE:Split hunk into %s and %s", first.header(), second.header())
+	}
+	return fmt.Errorf("PLUGIN_MESSAGE:No hunk at point")
+}
+
+// splitHunk splits hunk before the body line at buffer line splitLine, which
+// must be a context line with changes on both sides of it.
+func splitHunk(hunk *patchHunk, splitLine int) (*patchHunk, *patchHunk, error) {
+	at := -1
+	for i, l := range hunk.lines {
+		if l.bufLine == splitLine {
+			at = i
+		}
+	}
+	if at < 0 || hunk.lines[at].op != ' ' {
+		return nil, nil, fmt.Errorf("Hunks can only be split at a context line")
+	}
+
+	first := newHunk(hunk.lines, 0, at, hunk.oldIndex(), hunk.newIndex())
+	second := newHunk(hunk.lines, at, len(hunk.lines), hunk.oldIndex()+first.oldCount, hunk.newIndex()+first.newCount)
+	if !hasChanges(first) || !hasChanges(second) {
+		return nil, nil, fmt.Errorf("Splitting here would leave a hunk without changes")
+	}
+	first.section = hunk.section
+	return first, second, nil
+}
+
+func hasChanges(hunk *patchHunk) bool {
+	for _, l := range hunk.lines {
+		if l.op != ' ' {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHandleDiffRecountHunks(t *testing.T) {
+	// The first hunk lost a "+" line and the second gained a "-" line
+	// by hand; neither header was updated.
+	edited := `--- a
++++ b
+@@ -1,3 +1,4 @@
+ one
++two
+ three
+@@ -10,3 +11,3 @@
+ ten
+-eleven
+-eleven and a half
++ELEVEN
+ twelve
+`
+	diff := &mockBuffer{name: "patch", content: edited}
+	plugin := &BufferDiffPlugin{host: newMockHost(diff)}
+
+	err := plugin.ExecuteCommand("diff-recount-hunks")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:Recounted hunks: 2 headers updated" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+
+	expected := strings.Replace(strings.Replace(edited, "@@ -1,3 +1,4 @@", "@@ -1,2 +1,3 @@", 1), "@@ -10,3 +11,3 @@", "@@ -10,4 +11,3 @@", 1)
+	if diff.content != expected {
+		t.Errorf("Expected %q, got %q", expected, diff.content)
+	}
+	if _, err := parsePatch(diff.content); err != nil {
+		t.Errorf("Expected recounted diff to parse: %v", err)
+	}
+}
+
+func TestHandleDiffSplitHunk(t *testing.T) {
+	original := `--- a
++++ b
+@@ -1,6 +1,6 @@ func main
+ one
+-two
++TWO
+ three
+ four
+-five
++FIVE
+ six
+`
+	diff := &mockBuffer{name: "patch", content: original}
+	plugin := &BufferDiffPlugin{host: newMockHost(diff)}
+
+	diff.cursor = strings.Index(original, " four")
+	err := plugin.ExecuteCommand("diff-split-hunk")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:Split hunk into @@ -1,3 +1,3 @@ func main and @@ -4,3 +4,3 @@" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+
+	files, err := parsePatch(diff.content)
+	if err != nil {
+		t.Fatalf("Expected split diff to parse: %v", err)
+	}
+	if len(files[0].hunks) != 2 {
+		t.Fatalf("Expected 2 hunks, got %d", len(files[0].hunks))
+	}
+
+	lines := strings.Split("one\ntwo\nthree\nfour\nfive\nsix\n", "\n")
+	patched, _ := applyHunks(lines, files[0].hunks, exactApply)
+	if got := strings.Join(patched, "\n"); got != "one\nTWO\nthree\nfour\nFIVE\nsix\n" {
+		t.Errorf("Unexpected result of applying split hunks: %q", got)
+	}
+
+	diff.cursor = strings.Index(diff.content, "+TWO")
+	if err := plugin.ExecuteCommand("diff-split-hunk"); err == nil || err.Error() != "PLUGIN_MESSAGE:Hunks can only be split at a context line" {
+		t.Errorf("Expected refusal on a changed line, got %v", err)
+	}
+}
+
+func TestRecountHunksEmptyRanges(t *testing.T) {
+	tests := []struct {
+		name, edited, expected string
+	}{
+		// A context line was added after a pure insertion.
+		{"old side no longer empty", "@@ -3,0 +4 @@\n+new\n four", "@@ -4 +4,2 @@"},
+		// The only removed line was dropped, leaving a pure insertion.
+		{"old side now empty", "@@ -2 +2,2 @@\n+TWO\n+more", "@@ -1,0 +2,2 @@"},
+		// The only added line was dropped, leaving a pure removal.
+		{"new side now empty", "@@ -2 +2 @@\n-two", "@@ -2 +1,0 @@"},
+		// A context line was added after a pure removal.
+		{"new side no longer empty", "@@ -2 +1,0 @@\n-two\n three", "@@ -2,2 +2 @@"},
+	}
+	for _, test := range tests {
+		changed, err := recountHunks(strings.Split(test.edited, "\n"))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if changed[0] != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, changed[0])
+		}
+	}
+}
+
+func TestRecountedInsertionApplies(t *testing.T) {
+	changed, err := recountHunks([]string{"@@ -3,0 +4 @@", "+new", " four"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	files, err := parsePatch("--- a\n+++ b\n" + changed[0] + "\n+new\n four\n")
+	if err != nil {
+		t.Fatalf("Expected recounted diff to parse: %v", err)
+	}
+	lines := strings.Split("one\ntwo\nthree\nfour\nfive", "\n")
+	patched, results := applyHunks(lines, files[0].hunks, exactApply)
+	if !results[0].applied || results[0].offset != 0 {
+		t.Errorf("Expected the hunk to apply in place, got %+v", results[0])
+	}
+	if got := strings.Join(patched, "\n"); got != "one\ntwo\nthree\nnew\nfour\nfive" {
+		t.Errorf("Unexpected result: %q", got)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// diffMode is the major mode of the buffers this plugin fills with diffs,
+// and of .diff and .patch files.
+const diffMode = "diff-mode"
+
+// Syntax classes of diff-mode. The host colorizes a line with the first
+// class in diffSyntaxClasses whose pattern matches it.
+const (
+	syntaxHeader         = "diff-header"
+	syntaxHunkHeader     = "diff-hunk-header"
+	syntaxRemoved        = "diff-removed"
+	syntaxAdded          = "diff-added"
+	syntaxRefinedRemoved = "diff-refine-removed"
+	syntaxRefinedAdded   = "diff-refine-added"
+)
+
+var diffSyntaxClasses = []string{syntaxHeader, syntaxHunkHeader, syntaxRemoved, syntaxAdded}
+
+var diffSyntaxPatterns = map[string]string{
+	syntaxHeader:     `^(diff --git |index |new file mode |deleted file mode |--- |\+\+\+ )`,
+	syntaxHunkHeader: `^@@ -[0-9]+(,[0-9]+)? \+[0-9]+(,[0-9]+)? @@`,
+	syntaxRemoved:    `^-`,
+	syntaxAdded:      `^\+`,
+}
+
+// Host options through which diff-mode publishes its syntax. Refined words
+// differ per buffer, so they go to diffRefinedOption plus the buffer name.
+const (
+	diffSyntaxClassesOption = "diff-mode-syntax-classes"
+	diffSyntaxOption        = "diff-mode-syntax:"
+	diffRefinedOption       = "diff-mode-refined:"
+)
+
+// publishDiffSyntax tells the host the line classes of diff-mode: the class
+// names in order, and one pattern option per class.
+func (p *BufferDiffPlugin) publishDiffSyntax() {
+	if err := p.host.SetOption(diffSyntaxClassesOption, diffSyntaxClasses); err != nil {
+		fmt.Printf("[PLUGIN] Failed to publish diff-mode syntax: %v\n", err)
+		return
+	}
+	for _, class := range diffSyntaxClasses {
+		p.host.SetOption(diffSyntaxOption+class, diffSyntaxPatterns[class])
+	}
+}
+
+// setDiffMode puts bufferName in diff-mode and publishes its refined words
+// and folds.
+func (p *BufferDiffPlugin) setDiffMode(bufferName, content string) {
+	if err := p.host.SetMajorMode(bufferName, diffMode); err != nil {
+		fmt.Printf("[PLUGIN] Failed to set %s in '%s': %v\n", diffMode, bufferName, err)
+	}
+	p.publishRefinedWords(bufferName, content)
+	p.publishFolds(bufferName, content)
+}
+
+// publishRefinedWords sets the refined-words option of bufferName to flat
+// (line, start, end) triples in rune columns, end exclusive. Spans on '-'
+// lines are syntaxRefinedRemoved and spans on '+' lines syntaxRefinedAdded.
+func (p *BufferDiffPlugin) publishRefinedWords(bufferName, content string) {
+	files, err := parsePatch(content)
+	if err != nil {
+		fmt.Printf("[PLUGIN] publishRefinedWords: cannot parse '%s': %v\n", bufferName, err)
+		return
+	}
+	var spans []int
+	for _, file := range files {
+		for _, hunk := range file.hunks {
+			spans = append(spans, refineHunk(hunk)...)
+		}
+	}
+	p.setBufferOption(diffRefinedOption, bufferName, spans)
+}
+
+// refineHunk pairs the removed and added lines of every change in hunk, in
+// order, and returns the words that differ within each pair.
+func refineHunk(hunk *patchHunk) []int {
+	var spans []int
+	lines := hunk.lines
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			i++
+			continue
+		}
+		var removed, added []patchLine
+		for ; i < len(lines) && lines[i].op == '-'; i++ {
+			removed = append(removed, lines[i])
+		}
+		for ; i < len(lines) && lines[i].op == '+'; i++ {
+			added = append(added, lines[i])
+		}
+		for j := 0; j < len(removed) && j < len(added); j++ {
+			oldSpans, newSpans := refineWords(removed[j].text, added[j].text)
+			spans = append(spans, lineSpans(removed[j].bufLine, oldSpans)...)
+			spans = append(spans, lineSpans(added[j].bufLine, newSpans)...)
+		}
+	}
+	return spans
+}
+
+// lineSpans turns column spans of a line's text into triples for buffer
+// line line, shifted past the one-character prefix.
+func lineSpans(line int, spans [][2]int) []int {
+	var triples []int
+	for _, s := range spans {
+		triples = append(triples, line, s[0]+1, s[1]+1)
+	}
+	return triples
+}
+
+// refineWords returns the spans of old and new, in rune columns, that are
+// not part of the longest run of words the two lines share.
+func refineWords(old, new string) (oldSpans, newSpans [][2]int) {
+	a, b := splitWords(old), splitWords(new)
+	matches := matchLinesMyers(a, b)
+
+	matchedB := make([]bool, len(b))
+	matchedA := make([]bool, len(a))
+	for i, j := range matches {
+		if j >= 0 {
+			matchedA[i] = true
+			matchedB[j] = true
+		}
+	}
+	return wordSpans(a, matchedA), wordSpans(b, matchedB)
+}
+
+// wordSpans merges adjacent unmatched words into spans.
+func wordSpans(words []string, matched []bool) [][2]int {
+	var spans [][2]int
+	col := 0
+	for i, w := range words {
+		end := col + len([]rune(w))
+		if !matched[i] {
+			if n := len(spans); n > 0 && spans[n-1][1] == col {
+				spans[n-1][1] = end
+			} else {
+				spans = append(spans, [2]int{col, end})
+			}
+		}
+		col = end
+	}
+	return spans
+}
+
+// splitWords splits s into runs of letters, digits and underscores, runs of
+// whitespace, and single other characters.
+func splitWords(s string) []string {
+	class := func(r rune) int {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			return 1
+		case unicode.IsSpace(r):
+			return 2
+		}
+		return 0
+	}
+
+	var words []string
+	var word strings.Builder
+	prev := -1
+	for _, r := range s {
+		c := class(r)
+		if word.Len() > 0 && (c != prev || c == 0) {
+			words = append(words, word.String())
+			word.Reset()
+		}
+		word.WriteRune(r)
+		prev = c
+	}
+	if word.Len() > 0 {
+		words = append(words, word.String())
+	}
+	return words
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestGetMajorModes(t *testing.T) {
+	plugin := &BufferDiffPlugin{}
+	modes := plugin.GetMajorModes()
+	if len(modes) != 1 || modes[0].Name != diffMode {
+		t.Fatalf("Expected diff-mode, got %+v", modes)
+	}
+	if !reflect.DeepEqual(modes[0].Extensions, []string{".diff", ".patch"}) {
+		t.Errorf("Expected .diff and .patch extensions, got %v", modes[0].Extensions)
+	}
+}
+
+func TestDiffSyntaxPatterns(t *testing.T) {
+	tests := []struct {
+		line  string
+		class string
+	}{
+		{"diff --git a/x b/x", syntaxHeader},
+		{"--- a/x", syntaxHeader},
+		{"+++ b/x", syntaxHeader},
+		{"@@ -1,3 +1,4 @@ func main", syntaxHunkHeader},
+		{"-removed", syntaxRemoved},
+		{"+added", syntaxAdded},
+		{" context", ""},
+	}
+	for _, tt := range tests {
+		class := ""
+		for _, c := range diffSyntaxClasses {
+			if regexp.MustCompile(diffSyntaxPatterns[c]).MatchString(tt.line) {
+				class = c
+				break
+			}
+		}
+		if class != tt.class {
+			t.Errorf("%q: expected class %q, got %q", tt.line, tt.class, class)
+		}
+	}
+}
+
+func TestInitializePublishesDiffSyntax(t *testing.T) {
+	host := newMockHost()
+	plugin := &BufferDiffPlugin{}
+	plugin.Initialize(context.Background(), host)
+
+	if !reflect.DeepEqual(host.options[diffSyntaxClassesOption], diffSyntaxClasses) {
+		t.Errorf("Expected syntax classes to be published, got %v", host.options[diffSyntaxClassesOption])
+	}
+	if host.options[diffSyntaxOption+syntaxHunkHeader] != diffSyntaxPatterns[syntaxHunkHeader] {
+		t.Errorf("Expected hunk header pattern to be published, got %v", host.options[diffSyntaxOption+syntaxHunkHeader])
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	words := splitWords("x := foo(bar_1,  2)")
+	expected := []string{"x", " ", ":", "=", " ", "foo", "(", "bar_1", ",", "  ", "2", ")"}
+	if !reflect.DeepEqual(words, expected) {
+		t.Errorf("Expected %q, got %q", expected, words)
+	}
+}
+
+func TestRefineWords(t *testing.T) {
+	oldSpans, newSpans := refineWords("return foo(a, b)", "return bar(a, c, b)")
+	if !reflect.DeepEqual(oldSpans, [][2]int{{7, 10}}) {
+		t.Errorf("Unexpected old spans: %v", oldSpans)
+	}
+	if !reflect.DeepEqual(newSpans, [][2]int{{7, 10}, {12, 15}}) {
+		t.Errorf("Unexpected new spans: %v", newSpans)
+	}
+}
+
+func TestBufferDiffSetsDiffMode(t *testing.T) {
+	a := &mockBuffer{name: "a", content: "one\nsame old\nthree"}
+	b := &mockBuffer{name: "b", content: "one\nsame new\nthree"}
+	host := newMockHost(a, b)
+	plugin := &BufferDiffPlugin{host: host}
+
+	plugin.ExecuteCommand("buffer-diff", "a", "b")
+	diffName := "*Diff: a <-> b*"
+
+	if host.majorModes[diffName] != diffMode {
+		t.Errorf("Expected diff-mode in %s, got %q", diffName, host.majorModes[diffName])
+	}
+	// "-same old" and "+same new" are lines 4 and 5 of the diff buffer.
+	expected := []int{4, 6, 9, 5, 6, 9}
+	if !reflect.DeepEqual(host.options[diffRefinedOption+diffName], expected) {
+		t.Errorf("Expected refined words %v, got %v", expected, host.options[diffRefinedOption+diffName])
+	}
+}
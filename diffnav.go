@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	pluginsdk "github.com/TakahashiShuuhei/gmacs-plugin-sdk"
+)
+
+// currentDiff parses the current buffer as a diff and returns it with its
+// lines, its files and the line under the cursor.
+func (p *BufferDiffPlugin) currentDiff() (pluginsdk.BufferInterface, []string, []*filePatch, int, error) {
+	buffer := p.host.GetCurrentBuffer()
+	if buffer == nil {
+		return nil, nil, nil, 0, fmt.Errorf("PLUGIN_MESSAGE:No current buffer")
+	}
+	content := buffer.Content()
+	files, err := parsePatch(content)
+	if err != nil {
+		return nil, nil, nil, 0, fmt.Errorf("PLUGIN_MESSAGE:Invalid diff in %s: %v", buffer.Name(), err)
+	}
+	return buffer, strings.Split(content, "\n"), files, lineAt(content, buffer.CursorPosition()), nil
+}
+
+// hunkStarts returns the first buffer line of every hunk.
+func hunkStarts(files []*filePatch) []int {
+	var starts []int
+	for _, file := range files {
+		for _, hunk := range file.hunks {
+			first, _ := hunkSpan(hunk)
+			starts = append(starts, first)
+		}
+	}
+	return starts
+}
+
+// fileStarts returns the header line of every file, or its first hunk for
+// hunks without a file header.
+func fileStarts(files []*filePatch) []int {
+	var starts []int
+	for _, file := range files {
+		switch {
+		case file.headerLine >= 0:
+			starts = append(starts, file.headerLine)
+		case len(file.hunks) > 0:
+			first, _ := hunkSpan(file.hunks[0])
+			starts = append(starts, first)
+		}
+	}
+	return starts
+}
+
+func (p *BufferDiffPlugin) HandleDiffHunkNext() error {
+	return p.gotoDiffPosition(hunkStarts, true, "hunk")
+}
+
+func (p *BufferDiffPlugin) HandleDiffHunkPrev() error {
+	return p.gotoDiffPosition(hunkStarts, false, "hunk")
+}
+
+func (p *BufferDiffPlugin) HandleDiffFileNext() error {
+	return p.gotoDiffPosition(fileStarts, true, "file")
+}
+
+func (p *BufferDiffPlugin) HandleDiffFilePrev() error {
+	return p.gotoDiffPosition(fileStarts, false, "file")
+}
+
+// gotoDiffPosition moves the cursor to the next or previous of the lines
+// positions returns for the current diff. what names them in messages.
+func (p *BufferDiffPlugin) gotoDiffPosition(positions func([]*filePatch) []int, forward bool, what string) error {
+	if p.host == nil {
+		return fmt.Errorf("ERROR: host is nil")
+	}
+	buffer, lines, files, line, err := p.currentDiff()
+	if err != nil {
+		return err
+	}
+	starts := positions(files)
+	if len(starts) == 0 {
+		return fmt.Errorf("PLUGIN_MESSAGE:No %ss in %s", what, buffer.Name())
+	}
+
+	target := -1
+	for i, start := range starts {
+		if forward && start > line {
+			target = i
+			break
+		}
+		if !forward && start < line {
+			target = i
+		}
+	}
+	if target < 0 {
+		if forward {
+			return fmt.Errorf("PLUGIN_MESSAGE:No next %s", what)
+		}
+		return fmt.Errorf("PLUGIN_MESSAGE:No previous %s", what)
+	}
+
+	buffer.SetCursorPosition(lineOffset(strings.Join(lines, "\n"), starts[target]))
+	return fmt.Errorf("PLUGIN_MESSAGE:%s %d of %d", strings.ToUpper(what[:1])+what[1:], target+1, len(starts))
+}
+
+// HandleDiffHunkKill removes the hunk at point from the diff. An @@ hunk is
+// deleted, together with its file header when it is the file's only hunk.
+// In a full listing the hunk's lines are kept but its change is dropped:
+// removed lines become context and added lines go away. A buffer-diff
+// session forgets the killed differences, until the diff is refreshed.
+func (p *BufferDiffPlugin) HandleDiffHunkKill() error {
+	if p.host == nil {
+		return fmt.Errorf("ERROR: host is nil")
+	}
+	buffer, lines, files, line, err := p.currentDiff()
+	if err != nil {
+		return err
+	}
+	file, hunk, index := hunkAtLine(files, line)
+	if hunk == nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:No hunk at point")
+	}
+
+	start, end := hunkSpan(hunk)
+	message := fmt.Sprintf("Killed hunk %d", index)
+	var repl []string
+	if hunk.headerLine >= 0 {
+		for end+1 < len(lines) && strings.HasPrefix(lines[end+1], "\\") {
+			end++
+		}
+		if len(file.hunks) == 1 && file.headerLine >= 0 {
+			start = file.headerLine
+			message += " and its file header"
+		}
+	} else {
+		for _, l := range hunk.lines {
+			if l.op != '+' {
+				repl = append(repl, " "+l.text)
+			}
+		}
+	}
+
+	replaceLines(buffer, lines, start, end-start+1, repl)
+	if s := p.sessions[buffer.Name()]; s != nil {
+		s.dropChanges(start, end, len(repl)-(end-start+1))
+	}
+	buffer.SetCursorPosition(lineOffset(buffer.Content(), start))
+	p.clearHunkFolds(buffer.Name())
+	p.publishFolds(buffer.Name(), buffer.Content())
+	return fmt.Errorf("PLUGIN_MESSAGE:%s", message)
+}
+
+// HandleDiffRefresh regenerates a diff buffer made by buffer-diff from the
+// current contents of the compared buffers, with the algorithm, whitespace
+// and context settings it was made with. The cursor stays on the same
+// difference where that still exists.
+func (p *BufferDiffPlugin) HandleDiffRefresh() error {
+	if p.host == nil {
+		return fmt.Errorf("ERROR: host is nil")
+	}
+	buffer := p.host.GetCurrentBuffer()
+	if buffer == nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:No current buffer")
+	}
+	s, err := p.refreshDiff(buffer)
+	if err != nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:%v", err)
+	}
+	return fmt.Errorf("PLUGIN_MESSAGE:Diff refreshed: %d differences", len(s.hunks))
+}
+
+// refreshDiff regenerates buffer, a diff buffer made by buffer-diff, and
+// returns its new session.
+func (p *BufferDiffPlugin) refreshDiff(buffer pluginsdk.BufferInterface) (*diffSession, error) {
+	s := p.sessions[buffer.Name()]
+	if s == nil {
+		return nil, fmt.Errorf("%s was not produced by buffer-diff", buffer.Name())
+	}
+	if err := p.reloadSnapshot(s.bufferA); err != nil {
+		return nil, err
+	}
+	a := p.host.FindBuffer(s.bufferA)
+	if a == nil {
+		return nil, fmt.Errorf("Buffer not found: %s", s.bufferA)
+	}
+	b := p.host.FindBuffer(s.bufferB)
+	if b == nil {
+		return nil, fmt.Errorf("Buffer not found: %s", s.bufferB)
+	}
+
+	line := lineAt(buffer.Content(), buffer.CursorPosition())
+	change, offset := changeAtLine(s.hunks, line)
+
+	s = p.recomputeSession(buffer, a, b, s)
+	content := buffer.Content()
+	if change >= 0 && len(s.hunks) > 0 {
+		first, last := hunkSpan(s.hunks[min(change, len(s.hunks)-1)])
+		line = min(first+offset, last)
+	}
+	buffer.SetCursorPosition(lineOffset(content, min(line, strings.Count(content, "\n"))))
+	return s, nil
+}
+
+// changeAtLine returns the index of the last change starting at or before
+// diff buffer line, and how far into it line is. The index is -1 when line
+// comes before the first change.
+func changeAtLine(changes []*patchHunk, line int) (int, int) {
+	index, offset := -1, 0
+	for i, change := range changes {
+		first, _ := hunkSpan(change)
+		if first > line {
+			break
+		}
+		index, offset = i, line-first
+	}
+	return index, offset
+}
+
+// landOnFirstChange puts the cursor of a new diff buffer on its first
+// change and returns the lines that change starts at in a and b. With the
+// diff-move-source-cursors option the cursors of a and b move there too.
+func (p *BufferDiffPlugin) landOnFirstChange(diffBuffer, a, b pluginsdk.BufferInterface, change *patchHunk) (int, int) {
+	first, _ := hunkSpan(change)
+	diffBuffer.SetCursorPosition(lineOffset(diffBuffer.Content(), first))
+
+	contentA, contentB := a.Content(), b.Content()
+	lineA := min(change.oldIndex(), strings.Count(contentA, "\n"))
+	lineB := min(change.newIndex(), strings.Count(contentB, "\n"))
+	if p.boolOption("diff-move-source-cursors", false) {
+		a.SetCursorPosition(lineOffset(contentA, lineA))
+		b.SetCursorPosition(lineOffset(contentB, lineB))
+	}
+	return lineA, lineB
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const twoFilePatch = `diff --git a/x.go b/x.go
+index 1111111..2222222 100644
+--- a/x.go
++++ b/x.go
+@@ -1,2 +1,2 @@
+ one
+-two
++TWO
+@@ -10,2 +10,2 @@
+ ten
+-eleven
++ELEVEN
+diff --git a/y.go b/y.go
+--- a/y.go
++++ b/y.go
+@@ -1 +1 @@
+-old
+\ No newline at end of file
++new
+\ No newline at end of file`
+
+func TestDiffHunkAndFileNavigation(t *testing.T) {
+	diff := &mockBuffer{name: "changes.diff", content: twoFilePatch}
+	plugin := &BufferDiffPlugin{host: newMockHost(diff)}
+
+	steps := []struct {
+		command  string
+		expected string
+		line     string
+	}{
+		{"diff-hunk-next", "Hunk 1 of 3", "@@ -1,2"},
+		{"diff-hunk-next", "Hunk 2 of 3", "@@ -10,2"},
+		{"diff-file-next", "File 2 of 2", "diff --git a/y.go"},
+		{"diff-hunk-next", "Hunk 3 of 3", "@@ -1 +1"},
+		{"diff-hunk-next", "No next hunk", "@@ -1 +1"},
+		{"diff-file-prev", "File 2 of 2", "diff --git a/y.go"},
+		{"diff-file-prev", "File 1 of 2", "diff --git a/x.go"},
+		{"diff-hunk-prev", "No previous hunk", "diff --git a/x.go"},
+	}
+	for _, step := range steps {
+		err := plugin.ExecuteCommand(step.command)
+		if err == nil || err.Error() != "PLUGIN_MESSAGE:"+step.expected {
+			t.Errorf("%s: expected %q, got %v", step.command, step.expected, err)
+		}
+		if diff.cursor != strings.Index(diff.content, step.line) {
+			t.Errorf("%s: expected cursor on %q, got %d", step.command, step.line, diff.cursor)
+		}
+	}
+}
+
+func TestDiffHunkKill(t *testing.T) {
+	diff := &mockBuffer{name: "changes.diff", content: twoFilePatch}
+	plugin := &BufferDiffPlugin{host: newMockHost(diff)}
+
+	diff.cursor = strings.Index(diff.content, "-eleven")
+	if err := plugin.ExecuteCommand("diff-hunk-kill"); err == nil || err.Error() != "PLUGIN_MESSAGE:Killed hunk 2" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if strings.Contains(diff.content, "eleven") || !strings.Contains(diff.content, "+TWO\ndiff --git a/y.go") {
+		t.Errorf("Expected the second hunk to be removed, got %q", diff.content)
+	}
+
+	diff.cursor = strings.Index(diff.content, "+new")
+	if err := plugin.ExecuteCommand("diff-hunk-kill"); err == nil || err.Error() != "PLUGIN_MESSAGE:Killed hunk 1 and its file header" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if strings.Contains(diff.content, "y.go") || !strings.HasSuffix(diff.content, "+TWO") {
+		t.Errorf("Expected y.go to be removed, got %q", diff.content)
+	}
+}
+
+func TestDiffHunkKillListing(t *testing.T) {
+	a := &mockBuffer{name: "a", content: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12"}
+	b := &mockBuffer{name: "b", content: "1\ntwo\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve"}
+	host := newMockHost(a, b)
+	plugin := &BufferDiffPlugin{host: host}
+
+	plugin.ExecuteCommand("buffer-diff", "a", "b")
+	diff := host.buffers["*Diff: a <-> b*"]
+
+	diff.cursor = strings.Index(diff.content, "+two")
+	if err := plugin.ExecuteCommand("diff-hunk-kill"); err == nil || err.Error() != "PLUGIN_MESSAGE:Killed hunk 1" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if strings.Contains(diff.content, "two") || !strings.Contains(diff.content, "\n 1\n 2\n 3\n") {
+		t.Errorf("Expected the change to become context, got %q", diff.content)
+	}
+
+	// What is left still applies to a and only brings in the other hunk.
+	plugin.ExecuteCommand("patch-apply", "*Diff: a <-> b*", "a")
+	if a.content != "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve" {
+		t.Errorf("Unexpected content of a: %q", a.content)
+	}
+}
+
+func TestDiffRefresh(t *testing.T) {
+	a := &mockBuffer{name: "a", content: "one\ntwo"}
+	b := &mockBuffer{name: "b", content: "one\n2"}
+	host := newMockHost(a, b)
+	plugin := &BufferDiffPlugin{host: host}
+
+	plugin.ExecuteCommand("buffer-diff", "a", "b")
+	diff := host.buffers["*Diff: a <-> b*"]
+	b.content = "one\ntwo"
+
+	if err := plugin.ExecuteCommand("diff-refresh"); err == nil || err.Error() != "PLUGIN_MESSAGE:Diff refreshed: 0 differences" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if diff.content != "--- a\n+++ b\n\n one\n two" {
+		t.Errorf("Unexpected diff content: %q", diff.content)
+	}
+
+	host.current = "a"
+	if err := plugin.ExecuteCommand("diff-refresh"); err == nil || err.Error() != "PLUGIN_MESSAGE:a was not produced by buffer-diff" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+}
+
+func TestBufferDiffLandsOnFirstChange(t *testing.T) {
+	a := &mockBuffer{name: "a", content: "one\ntwo\nthree\nfour"}
+	b := &mockBuffer{name: "b", content: "one\ntwo\nTHREE\nfour"}
+	host := newMockHost(a, b)
+	plugin := &BufferDiffPlugin{host: host}
+
+	err := plugin.ExecuteCommand("buffer-diff", "a", "b")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:Buffer diff completed: 1 differences found, first at line 3 of a and line 3 of b" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	diff := host.buffers["*Diff: a <-> b*"]
+	if diff.cursor != strings.Index(diff.content, "-three") {
+		t.Errorf("Expected the cursor on the first change, got %d", diff.cursor)
+	}
+	if a.cursor != 0 || b.cursor != 0 {
+		t.Errorf("Expected the source cursors to stay, got %d and %d", a.cursor, b.cursor)
+	}
+
+	host.options["diff-move-source-cursors"] = true
+	plugin.ExecuteCommand("buffer-diff", "a", "b")
+	if a.cursor != strings.Index(a.content, "three") || b.cursor != strings.Index(b.content, "THREE") {
+		t.Errorf("Expected the source cursors on the first change, got %d and %d", a.cursor, b.cursor)
+	}
+
+	// Without differences the cursor goes to the top.
+	b.content = a.content
+	diff.cursor = 5
+	err = plugin.ExecuteCommand("buffer-diff", "a", "b")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:Buffer diff completed: 0 differences found" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if diff.cursor != 0 {
+		t.Errorf("Expected the cursor at the top, got %d", diff.cursor)
+	}
+}
+
+func TestDiffHunkKillUpdatesSession(t *testing.T) {
+	a := &mockBuffer{name: "a", content: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12"}
+	b := &mockBuffer{name: "b", content: "1\ntwo\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve"}
+	host := newMockHost(a, b)
+	plugin := &BufferDiffPlugin{host: host}
+
+	plugin.ExecuteCommand("buffer-diff", "a", "b")
+	diff := host.buffers["*Diff: a <-> b*"]
+
+	diff.cursor = strings.Index(diff.content, "+two")
+	plugin.ExecuteCommand("diff-hunk-kill")
+
+	// Only the second difference is left, on the lines it moved to.
+	if err := plugin.ExecuteCommand("diff-session-next"); err == nil || err.Error() != "PLUGIN_MESSAGE:Difference 1 of 1" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if diff.cursor != strings.Index(diff.content, "-12") {
+		t.Errorf("Expected the cursor on the remaining difference, got %d", diff.cursor)
+	}
+	if err := plugin.ExecuteCommand("diff-session-copy-a-to-b"); err == nil || err.Error() != "PLUGIN_MESSAGE:Copied difference 1 from a to b, 1 remaining" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if b.content != "1\ntwo\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12" {
+		t.Errorf("Unexpected content of b: %q", b.content)
+	}
+}
+
+func TestDiffHunkKillCurrentDifference(t *testing.T) {
+	a := &mockBuffer{name: "a", content: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12"}
+	b := &mockBuffer{name: "b", content: "1\ntwo\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve"}
+	host := newMockHost(a, b)
+	plugin := &BufferDiffPlugin{host: host}
+
+	plugin.ExecuteCommand("buffer-diff", "a", "b")
+	diff := host.buffers["*Diff: a <-> b*"]
+	plugin.ExecuteCommand("diff-session-next")
+	plugin.ExecuteCommand("diff-session-next")
+
+	// Killing the current difference leaves the position after the first.
+	plugin.ExecuteCommand("diff-hunk-kill")
+	if err := plugin.ExecuteCommand("diff-session-next"); err == nil || err.Error() != "PLUGIN_MESSAGE:No next difference" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if err := plugin.ExecuteCommand("diff-session-prev"); err == nil || err.Error() != "PLUGIN_MESSAGE:Difference 1 of 1" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if diff.cursor != strings.Index(diff.content, "-2") {
+		t.Errorf("Expected the cursor on the first difference, got %d", diff.cursor)
+	}
+}
+
+func TestDiffModeKeysInSessionBuffer(t *testing.T) {
+	a := &mockBuffer{name: "a", content: "one\ntwo"}
+	b := &mockBuffer{name: "b", content: "one\nTWO"}
+	host := newMockHost(a, b)
+	plugin := &BufferDiffPlugin{host: host}
+	plugin.ExecuteCommand("buffer-diff", "a", "b")
+
+	// The diff buffer is in diff-mode with the session mode on top; each
+	// key must reach a single command.
+	diffName := "*Diff: a <-> b*"
+	active := map[string]bool{host.majorModes[diffName]: true}
+	for key, on := range host.minorModes {
+		if on && strings.HasPrefix(key, diffName+" ") {
+			active[strings.TrimPrefix(key, diffName+" ")] = true
+		}
+	}
+	if !active[diffMode] || !active[diffSessionMode] {
+		t.Fatalf("Expected %s and %s in %s, got %v", diffMode, diffSessionMode, diffName, active)
+	}
+	bound := map[string][]string{}
+	for _, binding := range plugin.GetKeyBindings() {
+		if active[binding.Mode] {
+			bound[binding.Sequence] = append(bound[binding.Sequence], binding.Command)
+		}
+	}
+	for key, commands := range bound {
+		if len(commands) > 1 {
+			t.Errorf("Expected %s to reach one command, got %v", key, commands)
+		}
+	}
+	if len(bound["n"]) != 1 || bound["n"][0] != "diff-hunk-next" {
+		t.Errorf("Expected n to be diff-hunk-next, got %v", bound["n"])
+	}
+	if len(bound["p"]) != 1 || bound["p"][0] != "diff-hunk-prev" {
+		t.Errorf("Expected p to be diff-hunk-prev, got %v", bound["p"])
+	}
+}
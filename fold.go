@@ -0,0 +1,368 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	pluginsdk "github.com/TakahashiShuuhei/gmacs-plugin-sdk"
+)
+
+// Folds are published to the host rather than cut out of the buffer, so
+// folded diffs still parse and apply. diffFoldsOption plus a buffer name
+// holds flat (first, last) pairs of hidden lines, and diffFoldLabelsOption
+// the placeholder the host shows in place of each pair. Hosts that hide
+// those lines set diffHostFoldsOption; for other hosts unchanged runs are
+// cut out of the buffer and a placeholder line written in their place.
+const (
+	diffFoldsOption      = "diff-folds:"
+	diffFoldLabelsOption = "diff-fold-labels:"
+	diffHostFoldsOption  = "diff-host-folds"
+)
+
+// unchangedLabel is the placeholder of a collapsed unchanged run. As a line
+// of a full listing it stands for that many unchanged lines; no diff line
+// starts with its first rune.
+const unchangedLabel = "… %d unchanged lines …"
+
+// placeholderCount returns the number of lines a placeholder line stands
+// for, and false for any other line.
+func placeholderCount(line string) (int, bool) {
+	rest, ok := strings.CutPrefix(line, "… ")
+	if !ok {
+		return 0, false
+	}
+	rest, ok = strings.CutSuffix(rest, " unchanged lines …")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(rest)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// listingStart is the first listing line of a full buffer-diff listing,
+// after the ---/+++ header and the blank line renderDiff writes.
+const listingStart = 3
+
+// fold is a range of hidden lines and the placeholder shown for them.
+type fold struct {
+	first, last int
+	label       string
+	// key identifies an unchanged run across refreshes: the line of A it
+	// starts at.
+	key int
+}
+
+// foldState is what was folded or expanded by hand in a diff buffer.
+type foldState struct {
+	// expanded holds the unchanged runs shown in full, by fold key.
+	expanded map[int]bool
+	// hunks holds the folded hunks, by their first buffer line.
+	hunks map[int]bool
+	// collapsed holds the runs cut out of the buffer, in buffer order, one
+	// per placeholder line. Only used when the host cannot hide lines.
+	collapsed []collapsedRun
+}
+
+// collapsedRun is an unchanged run replaced by a placeholder line.
+type collapsedRun struct {
+	key   int
+	lines []string
+}
+
+// unchangedRuns returns the runs of unchanged lines in a full listing with
+// lineCount lines that are long enough to collapse. listingContext lines
+// next to each change stay visible, so the hunks parsed from the listing
+// never reach into a run. A threshold of 0 or less collapses nothing.
+func unchangedRuns(changes []*patchHunk, lineCount, threshold int) []fold {
+	if threshold <= 0 {
+		return nil
+	}
+	var runs []fold
+	add := func(first, last, oldLine int, afterChange, beforeChange bool) {
+		if afterChange {
+			first += listingContext
+			oldLine += listingContext
+		}
+		if beforeChange {
+			last -= listingContext
+		}
+		if hidden := last - first + 1; hidden >= threshold {
+			runs = append(runs, fold{first: first, last: last, label: fmt.Sprintf(unchangedLabel, hidden), key: oldLine})
+		}
+	}
+
+	start, oldLine := listingStart, 0
+	for i, change := range changes {
+		first, last := hunkSpan(change)
+		add(start, first-1, oldLine, i > 0, true)
+		start, oldLine = last+1, change.oldIndex()+change.oldCount
+	}
+	add(start, lineCount-1, oldLine, len(changes) > 0, false)
+	return runs
+}
+
+func (p *BufferDiffPlugin) foldState(bufferName string) *foldState {
+	if p.folds == nil {
+		p.folds = map[string]*foldState{}
+	}
+	state := p.folds[bufferName]
+	if state == nil {
+		state = &foldState{expanded: map[int]bool{}, hunks: map[int]bool{}}
+		p.folds[bufferName] = state
+	}
+	return state
+}
+
+// collapsibleRuns returns the unchanged runs of a buffer-diff listing,
+// folded or not. Other buffers have none.
+func (p *BufferDiffPlugin) collapsibleRuns(bufferName, content string) []fold {
+	s := p.sessions[bufferName]
+	if s == nil || s.params.context >= 0 {
+		return nil
+	}
+	return unchangedRuns(s.hunks, strings.Count(content, "\n")+1, p.intOption("diff-collapse-unchanged", 20))
+}
+
+// diffFolds returns the hidden ranges of bufferName in order: unchanged runs
+// not expanded, and folded hunks. A folded @@ hunk keeps its header visible.
+func (p *BufferDiffPlugin) diffFolds(bufferName, content string) []fold {
+	state := p.folds[bufferName]
+	var folds []fold
+	for _, run := range p.collapsibleRuns(bufferName, content) {
+		if state == nil || !state.expanded[run.key] {
+			folds = append(folds, run)
+		}
+	}
+
+	if state != nil && len(state.hunks) > 0 {
+		files, err := parsePatch(content)
+		if err != nil {
+			fmt.Printf("[PLUGIN] diffFolds: cannot parse '%s': %v\n", bufferName, err)
+			files = nil
+		}
+		for _, file := range files {
+			for _, hunk := range file.hunks {
+				first, last := hunkSpan(hunk)
+				if !state.hunks[first] {
+					continue
+				}
+				if hunk.headerLine >= 0 {
+					first++
+				}
+				if last >= first {
+					folds = append(folds, fold{first: first, last: last, label: fmt.Sprintf("… %d lines folded …", last-first+1)})
+				}
+			}
+		}
+	}
+
+	sort.Slice(folds, func(i, j int) bool { return folds[i].first < folds[j].first })
+	return folds
+}
+
+// publishFolds tells the host which lines of bufferName to hide, or
+// collapses them into placeholder lines when the host cannot hide lines.
+func (p *BufferDiffPlugin) publishFolds(bufferName, content string) {
+	if !p.boolOption(diffHostFoldsOption, false) {
+		p.collapseRuns(bufferName, content)
+		return
+	}
+	pairs := []int{}
+	labels := []string{}
+	for _, f := range p.diffFolds(bufferName, content) {
+		pairs = append(pairs, f.first, f.last)
+		labels = append(labels, f.label)
+	}
+	if err := p.setBufferOption(diffFoldsOption, bufferName, pairs); err != nil {
+		fmt.Printf("[PLUGIN] Failed to publish folds of '%s': %v\n", bufferName, err)
+		return
+	}
+	p.setBufferOption(diffFoldLabelsOption, bufferName, labels)
+}
+
+// collapseRuns replaces each unchanged run of bufferName that is not
+// expanded with a placeholder line, and keeps the cut lines to expand it
+// again. The session's differences and the cursor move with their lines.
+func (p *BufferDiffPlugin) collapseRuns(bufferName, content string) {
+	buffer := p.host.FindBuffer(bufferName)
+	if buffer == nil {
+		return
+	}
+	state := p.foldState(bufferName)
+	lines := strings.Split(content, "\n")
+	placeholders := 0
+	for _, line := range lines {
+		if _, ok := placeholderCount(line); ok {
+			placeholders++
+		}
+	}
+	if placeholders == 0 {
+		// The buffer was rewritten, so its placeholders are gone.
+		state.collapsed = nil
+	}
+
+	var runs []fold
+	for _, run := range p.collapsibleRuns(bufferName, content) {
+		if state.expanded[run.key] || hasPlaceholder(lines[run.first:run.last+1]) {
+			continue
+		}
+		runs = append(runs, run)
+	}
+	if len(runs) == 0 {
+		return
+	}
+
+	// moved maps each line to its line after collapsing.
+	moved := make([]int, len(lines))
+	var out []string
+	var collapsed []collapsedRun
+	seen := 0
+	for i := 0; i < len(lines); i++ {
+		if len(runs) > 0 && i == runs[0].first {
+			run := runs[0]
+			runs = runs[1:]
+			for j := run.first; j <= run.last; j++ {
+				moved[j] = len(out)
+			}
+			collapsed = append(collapsed, collapsedRun{key: run.key, lines: append([]string(nil), lines[run.first:run.last+1]...)})
+			out = append(out, run.label)
+			i = run.last
+			continue
+		}
+		if _, ok := placeholderCount(lines[i]); ok {
+			if seen < len(state.collapsed) {
+				collapsed = append(collapsed, state.collapsed[seen])
+			} else {
+				collapsed = append(collapsed, collapsedRun{key: -1})
+			}
+			seen++
+		}
+		moved[i] = len(out)
+		out = append(out, lines[i])
+	}
+
+	cursor := lineAt(content, buffer.CursorPosition())
+	folded := strings.Join(out, "\n")
+	buffer.SetContent(folded)
+	buffer.SetCursorPosition(lineOffset(folded, moved[min(cursor, len(moved)-1)]))
+	state.collapsed = collapsed
+	if s := p.sessions[bufferName]; s != nil {
+		for _, hunk := range s.hunks {
+			for j := range hunk.lines {
+				hunk.lines[j].bufLine = moved[hunk.lines[j].bufLine]
+			}
+		}
+	}
+	p.publishRefinedWords(bufferName, folded)
+}
+
+func hasPlaceholder(lines []string) bool {
+	for _, line := range lines {
+		if _, ok := placeholderCount(line); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// expandPlaceholder puts back the lines cut out for the placeholder at line
+// of buffer, the index-th placeholder in it.
+func (p *BufferDiffPlugin) expandPlaceholder(buffer pluginsdk.BufferInterface, lines []string, line, index int) error {
+	state := p.foldState(buffer.Name())
+	if index >= len(state.collapsed) || state.collapsed[index].lines == nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:The lines behind this placeholder are gone; run diff-refresh")
+	}
+	run := state.collapsed[index]
+	replaceLines(buffer, lines, line, 1, run.lines)
+	state.collapsed = append(state.collapsed[:index], state.collapsed[index+1:]...)
+	state.expanded[run.key] = true
+	if s := p.sessions[buffer.Name()]; s != nil {
+		for _, hunk := range s.hunks {
+			for j := range hunk.lines {
+				if hunk.lines[j].bufLine > line {
+					hunk.lines[j].bufLine += len(run.lines) - 1
+				}
+			}
+		}
+	}
+	buffer.SetCursorPosition(lineOffset(buffer.Content(), line))
+	p.publishRefinedWords(buffer.Name(), buffer.Content())
+	return fmt.Errorf("PLUGIN_MESSAGE:Expanded %d unchanged lines", len(run.lines))
+}
+
+// clearHunkFolds unfolds every hunk of bufferName, whose lines have moved.
+// Expanded unchanged runs are kept.
+func (p *BufferDiffPlugin) clearHunkFolds(bufferName string) {
+	if state := p.folds[bufferName]; state != nil {
+		state.hunks = map[int]bool{}
+	}
+}
+
+// HandleDiffFoldToggle expands or collapses the unchanged run at point, or
+// folds or unfolds the hunk at point.
+func (p *BufferDiffPlugin) HandleDiffFoldToggle() error {
+	if p.host == nil {
+		return fmt.Errorf("ERROR: host is nil")
+	}
+	buffer := p.host.GetCurrentBuffer()
+	if buffer == nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:No current buffer")
+	}
+	name := buffer.Name()
+	content := buffer.Content()
+	line := lineAt(content, buffer.CursorPosition())
+	state := p.foldState(name)
+
+	lines := strings.Split(content, "\n")
+	if _, ok := placeholderCount(lines[line]); ok {
+		index := 0
+		for _, l := range lines[:line] {
+			if _, ok := placeholderCount(l); ok {
+				index++
+			}
+		}
+		return p.expandPlaceholder(buffer, lines, line, index)
+	}
+
+	for _, run := range p.collapsibleRuns(name, content) {
+		if line < run.first || line > run.last {
+			continue
+		}
+		message := fmt.Sprintf("Expanded %d unchanged lines", run.last-run.first+1)
+		if state.expanded[run.key] {
+			delete(state.expanded, run.key)
+			message = fmt.Sprintf("Collapsed %d unchanged lines", run.last-run.first+1)
+		} else {
+			state.expanded[run.key] = true
+		}
+		p.publishFolds(name, content)
+		return fmt.Errorf("PLUGIN_MESSAGE:%s", message)
+	}
+
+	files, err := parsePatch(content)
+	if err != nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:Invalid diff in %s: %v", name, err)
+	}
+	_, hunk, index := hunkAtLine(files, line)
+	if hunk == nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:Nothing to fold at point")
+	}
+	if !p.boolOption(diffHostFoldsOption, false) {
+		return fmt.Errorf("PLUGIN_MESSAGE:Folding hunks needs a host that hides lines (%s)", diffHostFoldsOption)
+	}
+	first, _ := hunkSpan(hunk)
+	message := fmt.Sprintf("Folded hunk %d", index)
+	if state.hunks[first] {
+		delete(state.hunks, first)
+		message = fmt.Sprintf("Unfolded hunk %d", index)
+	} else {
+		state.hunks[first] = true
+	}
+	p.publishFolds(name, content)
+	return fmt.Errorf("PLUGIN_MESSAGE:%s", message)
+}
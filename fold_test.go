@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func numberedLines(n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d", i+1)
+	}
+	return lines
+}
+
+func TestDiffFolds(t *testing.T) {
+	lines := numberedLines(60)
+	a := &mockBuffer{name: "a", content: strings.Join(lines, "\n")}
+	lines[29] = "changed"
+	b := &mockBuffer{name: "b", content: strings.Join(lines, "\n")}
+	host := newMockHost(a, b)
+	host.options[diffHostFoldsOption] = true
+	plugin := &BufferDiffPlugin{host: host}
+
+	plugin.ExecuteCommand("buffer-diff", "a", "b")
+	name := "*Diff: a <-> b*"
+	diff := host.buffers[name]
+
+	// Line 30 becomes buffer lines 32-33; three lines stay visible on each
+	// side of it.
+	if !reflect.DeepEqual(host.options[diffFoldsOption+name], []int{3, 28, 37, 63}) {
+		t.Errorf("Unexpected folds: %v", host.options[diffFoldsOption+name])
+	}
+	expectedLabels := []string{"… 26 unchanged lines …", "… 27 unchanged lines …"}
+	if !reflect.DeepEqual(host.options[diffFoldLabelsOption+name], expectedLabels) {
+		t.Errorf("Expected labels %q, got %v", expectedLabels, host.options[diffFoldLabelsOption+name])
+	}
+
+	diff.cursor = lineOffset(diff.content, 40)
+	if err := plugin.ExecuteCommand("diff-fold-toggle"); err == nil || err.Error() != "PLUGIN_MESSAGE:Expanded 27 unchanged lines" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if !reflect.DeepEqual(host.options[diffFoldsOption+name], []int{3, 28}) {
+		t.Errorf("Unexpected folds after expanding: %v", host.options[diffFoldsOption+name])
+	}
+
+	diff.cursor = lineOffset(diff.content, 32)
+	if err := plugin.ExecuteCommand("diff-fold-toggle"); err == nil || err.Error() != "PLUGIN_MESSAGE:Folded hunk 1" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if !reflect.DeepEqual(host.options[diffFoldsOption+name], []int{3, 28, 29, 36}) {
+		t.Errorf("Unexpected folds after folding the hunk: %v", host.options[diffFoldsOption+name])
+	}
+
+	// Refreshing keeps the expanded run but unfolds hunks.
+	lines[29] = "changed again"
+	b.content = strings.Join(lines, "\n")
+	plugin.ExecuteCommand("diff-refresh")
+	if !reflect.DeepEqual(host.options[diffFoldsOption+name], []int{3, 28}) {
+		t.Errorf("Unexpected folds after refresh: %v", host.options[diffFoldsOption+name])
+	}
+
+	diff.cursor = lineOffset(diff.content, 50)
+	if err := plugin.ExecuteCommand("diff-fold-toggle"); err == nil || err.Error() != "PLUGIN_MESSAGE:Collapsed 27 unchanged lines" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	diff.cursor = lineOffset(diff.content, 1)
+	if err := plugin.ExecuteCommand("diff-fold-toggle"); err == nil || err.Error() != "PLUGIN_MESSAGE:Nothing to fold at point" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+}
+
+func TestDiffFoldPlaceholders(t *testing.T) {
+	lines := numberedLines(60)
+	a := &mockBuffer{name: "a", content: strings.Join(lines, "\n")}
+	lines[29] = "changed"
+	b := &mockBuffer{name: "b", content: strings.Join(lines, "\n")}
+	host := newMockHost(a, b)
+	plugin := &BufferDiffPlugin{host: host}
+
+	// Without diff-host-folds the runs are cut out of the buffer.
+	err := plugin.ExecuteCommand("buffer-diff", "a", "b")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:Buffer diff completed: 1 differences found, first at line 30 of a and line 30 of b" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	name := "*Diff: a <-> b*"
+	diff := host.buffers[name]
+	expected := "--- a\n+++ b\n\n… 26 unchanged lines …\n line 27\n line 28\n line 29\n-line 30\n+changed\n" +
+		" line 31\n line 32\n line 33\n… 27 unchanged lines …"
+	if diff.content != expected {
+		t.Errorf("Expected %q, got %q", expected, diff.content)
+	}
+	if _, ok := host.options[diffFoldsOption+name]; ok {
+		t.Errorf("Expected no %s option without host support", diffFoldsOption)
+	}
+	if diff.cursor != lineOffset(diff.content, 7) {
+		t.Errorf("Expected the cursor on the change, got %d", diff.cursor)
+	}
+
+	// Placeholders count as the lines they stand for.
+	files, err := parsePatch(diff.content)
+	if err != nil || len(files) != 1 || len(files[0].hunks) != 1 {
+		t.Fatalf("Expected one hunk, got %v, %v", files, err)
+	}
+	if hunk := files[0].hunks[0]; hunk.oldStart != 27 || hunk.newStart != 27 || hunk.lines[0].bufLine != 4 {
+		t.Errorf("Unexpected hunk: %+v", hunk)
+	}
+	loc, ok := diffSource(strings.Split(diff.content, "\n"), files, 12, 5)
+	if !ok || loc != (sourceLocation{name: "b", line: 33}) {
+		t.Errorf("Expected the placeholder to go to its first hidden line, got %+v", loc)
+	}
+
+	diff.cursor = lineOffset(diff.content, 12)
+	if err := plugin.ExecuteCommand("diff-fold-toggle"); err == nil || err.Error() != "PLUGIN_MESSAGE:Expanded 27 unchanged lines" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	diff.cursor = lineOffset(diff.content, 3)
+	if err := plugin.ExecuteCommand("diff-fold-toggle"); err == nil || err.Error() != "PLUGIN_MESSAGE:Expanded 26 unchanged lines" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if strings.Count(diff.content, "\n") != 63 || strings.Contains(diff.content, "…") {
+		t.Errorf("Expected the full listing back, got %q", diff.content)
+	}
+	if first, _ := hunkSpan(plugin.sessions[name].hunks[0]); first != 32 {
+		t.Errorf("Expected the difference to move to line 32, got %d", first)
+	}
+
+	diff.cursor = lineOffset(diff.content, 10)
+	if err := plugin.ExecuteCommand("diff-fold-toggle"); err == nil || err.Error() != "PLUGIN_MESSAGE:Collapsed 26 unchanged lines" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if lineAt(diff.content, diff.cursor) != 3 || !strings.HasPrefix(diff.content, "--- a\n+++ b\n\n… 26 unchanged lines …\n line 27") {
+		t.Errorf("Expected the run collapsed under the cursor, got %q", diff.content)
+	}
+	if err := plugin.ExecuteCommand("diff-session-next"); err == nil || err.Error() != "PLUGIN_MESSAGE:Difference 1 of 1" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if lineAt(diff.content, diff.cursor) != 7 {
+		t.Errorf("Expected the session to follow the collapse, got line %d", lineAt(diff.content, diff.cursor))
+	}
+	if err := plugin.ExecuteCommand("diff-fold-toggle"); err == nil || err.Error() != "PLUGIN_MESSAGE:Folding hunks needs a host that hides lines (diff-host-folds)" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+
+	// The folded listing still applies as a patch.
+	if err := plugin.ExecuteCommand("patch-apply", name, "a"); err == nil || !strings.Contains(err.Error(), "applied") {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if a.content != b.content {
+		t.Errorf("Expected a to match b after applying the diff, got %q", a.content)
+	}
+}
+
+func TestFoldPatchHunk(t *testing.T) {
+	buffer := &mockBuffer{name: "fix.patch", content: twoFilePatch}
+	host := newMockHost(buffer)
+	host.options[diffHostFoldsOption] = true
+	plugin := &BufferDiffPlugin{host: host}
+
+	// The first @@ header is line 4; its body stays hidden behind it.
+	buffer.cursor = lineOffset(twoFilePatch, 5)
+	if err := plugin.ExecuteCommand("diff-fold-toggle"); err == nil || err.Error() != "PLUGIN_MESSAGE:Folded hunk 1" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if !reflect.DeepEqual(host.options[diffFoldsOption+"fix.patch"], []int{5, 7}) {
+		t.Errorf("Unexpected folds: %v", host.options[diffFoldsOption+"fix.patch"])
+	}
+	if !reflect.DeepEqual(host.options[diffFoldLabelsOption+"fix.patch"], []string{"… 3 lines folded …"}) {
+		t.Errorf("Unexpected labels: %v", host.options[diffFoldLabelsOption+"fix.patch"])
+	}
+	if err := plugin.ExecuteCommand("diff-fold-toggle"); err == nil || err.Error() != "PLUGIN_MESSAGE:Unfolded hunk 1" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if !reflect.DeepEqual(host.options[diffFoldsOption+"fix.patch"], []int{}) {
+		t.Errorf("Expected no folds, got %v", host.options[diffFoldsOption+"fix.patch"])
+	}
+}
+
+func TestUnchangedRunsThreshold(t *testing.T) {
+	if runs := unchangedRuns(nil, 100, 0); runs != nil {
+		t.Errorf("Expected no runs with a zero threshold, got %v", runs)
+	}
+	runs := unchangedRuns(nil, 100, 20)
+	if len(runs) != 1 || runs[0].first != listingStart || runs[0].last != 99 {
+		t.Errorf("Expected the whole listing to collapse, got %v", runs)
+	}
+}
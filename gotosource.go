@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	pluginsdk "github.com/TakahashiShuuhei/gmacs-plugin-sdk"
+)
+
+// sourceLocation is the place in a compared buffer or file that a diff line
+// stands for.
+type sourceLocation struct {
+	name   string // buffer name or path, without git's a/ or b/ prefix
+	line   int    // 0-based
+	column int    // 0-based, in runes
+}
+
+// diffSource maps buffer line index of a diff to its source. Removed lines
+// map to the old side and context and added lines to the new side; headers
+// map to the first line of their hunk. Lines of a full listing are counted
+// from its start, so those far from any change map too, and a placeholder
+// of collapsed lines maps to the first of them. column is the cursor column
+// in the diff line.
+func diffSource(lines []string, files []*filePatch, index, column int) (sourceLocation, bool) {
+	file, hunk := listingAtLine(files, index)
+	if hunk == nil {
+		file, hunk, _ = hunkAtLine(files, index)
+	}
+	if hunk == nil && isHeaderLine(lines, index) {
+		// On a file header: go to its first hunk.
+		for _, f := range files {
+			if f.headerLine >= 0 && f.headerLine <= index && len(f.hunks) > 0 {
+				if first, _ := hunkSpan(f.hunks[0]); index < first {
+					file, hunk = f, f.hunks[0]
+				}
+			}
+		}
+		column = 0
+	}
+	if hunk == nil {
+		return sourceLocation{}, false
+	}
+
+	old := false
+	line := hunk.newIndex()
+	oldLine, newLine := hunk.oldIndex(), hunk.newIndex()
+	found := false
+	for _, l := range hunk.lines {
+		if l.bufLine == index {
+			old = l.op == '-'
+			line = newLine
+			if old {
+				line = oldLine
+			}
+			found = true
+			break
+		}
+		if l.op != '+' {
+			oldLine++
+		}
+		if l.op != '-' {
+			newLine++
+		}
+	}
+	if !found {
+		column = 0
+	} else if _, ok := placeholderCount(lines[index]); ok {
+		column = 0
+	}
+
+	name := file.newName
+	if old || name == devNull {
+		if !old {
+			line = hunk.oldIndex()
+		}
+		name = file.oldName
+	}
+	if file.gitStyle() {
+		name = name[2:]
+	}
+	// The first column of a body line is its -, + or space prefix.
+	return sourceLocation{name: name, line: line, column: max(column-1, 0)}, true
+}
+
+// listingAtLine returns the file whose full listing covers buffer line
+// index, and the listing as a single hunk starting at the top of both sides.
+func listingAtLine(files []*filePatch, index int) (*filePatch, *patchHunk) {
+	for _, f := range files {
+		if n := len(f.listing); n > 0 && index >= f.listing[0].bufLine && index <= f.listing[n-1].bufLine {
+			return f, newHunk(f.listing, 0, n, 0, 0)
+		}
+	}
+	return nil, nil
+}
+
+// isHeaderLine reports whether line index is part of a file header: a
+// "diff --git" line or a ---/+++ pair.
+func isHeaderLine(lines []string, index int) bool {
+	if index < 0 || index >= len(lines) {
+		return false
+	}
+	return strings.HasPrefix(lines[index], "diff --git ") || isFileHeader(lines, index) ||
+		(index > 0 && isFileHeader(lines, index-1))
+}
+
+// HandleDiffGotoSource shows the source of the diff line under the cursor,
+// with the cursor on the same line and column there. Buffers compared by
+// buffer-diff are found by name; otherwise the file is opened.
+func (p *BufferDiffPlugin) HandleDiffGotoSource() error {
+	if p.host == nil {
+		return fmt.Errorf("ERROR: host is nil")
+	}
+	diffBuffer, lines, files, index, err := p.currentDiff()
+	if err != nil {
+		return err
+	}
+	column := diffBuffer.CursorPosition() - lineOffset(strings.Join(lines, "\n"), index)
+	loc, ok := diffSource(lines, files, index, column)
+	if !ok {
+		return fmt.Errorf("PLUGIN_MESSAGE:No hunk at point")
+	}
+
+	var source pluginsdk.BufferInterface
+	if source = p.host.FindBuffer(loc.name); source == nil {
+		if source, err = p.openFileBuffer(loc.name); err != nil {
+			return fmt.Errorf("PLUGIN_MESSAGE:Cannot visit %s: %v", loc.name, err)
+		}
+	}
+	if err := p.host.SwitchToBuffer(source.Name()); err != nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:Failed to switch to %s: %v", source.Name(), err)
+	}
+
+	content := source.Content()
+	sourceLines := strings.Split(content, "\n")
+	line := min(loc.line, len(sourceLines)-1)
+	column = min(loc.column, utf8.RuneCountInString(sourceLines[line]))
+	source.SetCursorPosition(lineOffset(content, line) + column)
+
+	return fmt.Errorf("PLUGIN_MESSAGE:%s line %d", source.Name(), line+1)
+}
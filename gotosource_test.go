@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiffSource(t *testing.T) {
+	files, err := parsePatch(twoFilePatch)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	lines := strings.Split(twoFilePatch, "\n")
+	index := func(line string) int {
+		for i, l := range lines {
+			if l == line {
+				return i
+			}
+		}
+		t.Fatalf("Line %q not found", line)
+		return -1
+	}
+
+	tests := []struct {
+		index    int
+		column   int
+		expected sourceLocation
+	}{
+		{index("-eleven"), 3, sourceLocation{name: "x.go", line: 10, column: 2}},
+		{index("+ELEVEN"), 0, sourceLocation{name: "x.go", line: 10, column: 0}},
+		{index(" ten"), 2, sourceLocation{name: "x.go", line: 9, column: 1}},
+		{index("@@ -10,2 +10,2 @@"), 5, sourceLocation{name: "x.go", line: 9, column: 0}},
+		{index("+++ b/y.go"), 2, sourceLocation{name: "y.go", line: 0, column: 0}},
+	}
+	for _, tt := range tests {
+		loc, ok := diffSource(lines, files, tt.index, tt.column)
+		if !ok || loc != tt.expected {
+			t.Errorf("%q: expected %+v, got %+v (%v)", lines[tt.index], tt.expected, loc, ok)
+		}
+	}
+}
+
+func TestHandleDiffGotoSource(t *testing.T) {
+	a := &mockBuffer{name: "a", content: "one\ntwo\nthree"}
+	b := &mockBuffer{name: "b", content: "one\nzero\ntwo\nthree!"}
+	host := newMockHost(a, b)
+	plugin := &BufferDiffPlugin{host: host}
+
+	plugin.ExecuteCommand("buffer-diff", "a", "b")
+	diff := host.buffers["*Diff: a <-> b*"]
+
+	diff.cursor = strings.Index(diff.content, "+three!") + 4
+	if err := plugin.ExecuteCommand("diff-goto-source"); err == nil || err.Error() != "PLUGIN_MESSAGE:b line 4" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if host.current != "b" || b.cursor != strings.Index(b.content, "three!")+3 {
+		t.Errorf("Expected cursor on column 3 of line 4 of b, got %s at %d", host.current, b.cursor)
+	}
+
+	host.current = diff.name
+	diff.cursor = strings.Index(diff.content, "-three")
+	if err := plugin.ExecuteCommand("diff-goto-source"); err == nil || err.Error() != "PLUGIN_MESSAGE:a line 3" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if host.current != "a" || a.cursor != strings.Index(a.content, "three") {
+		t.Errorf("Expected cursor on line 3 of a, got %s at %d", host.current, a.cursor)
+	}
+}
+
+func TestHandleDiffGotoSourceOpensFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "x.go")
+	os.WriteFile(path, []byte("one\nTWO\nthree"), 0644)
+
+	patch := "--- " + path + "\n+++ " + path + "\n@@ -1,2 +1,2 @@\n one\n-two\n+TWO"
+	diff := &mockBuffer{name: "changes.diff", content: patch}
+	host := newMockHost(diff)
+	plugin := &BufferDiffPlugin{host: host}
+
+	diff.cursor = strings.Index(diff.content, "+TWO")
+	if err := plugin.ExecuteCommand("diff-goto-source"); err == nil || err.Error() != "PLUGIN_MESSAGE:"+path+" line 2" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if host.current != path || host.buffers[path].cursor != 4 {
+		t.Errorf("Expected cursor on line 2 of %s, got %s", path, host.current)
+	}
+}
+
+func TestHandleDiffGotoSourceFarFromChanges(t *testing.T) {
+	a := &mockBuffer{name: "a", content: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10"}
+	b := &mockBuffer{name: "b", content: "1\n2\n3\n4\n5\n6\n7\n8\n9\nten"}
+	host := newMockHost(a, b)
+	plugin := &BufferDiffPlugin{host: host}
+
+	plugin.ExecuteCommand("buffer-diff", "a", "b")
+	diff := host.buffers["*Diff: a <-> b*"]
+
+	// " 2" is well outside the context kept around the change on line 10.
+	diff.cursor = strings.Index(diff.content, "\n 2\n") + 1
+	if err := plugin.ExecuteCommand("diff-goto-source"); err == nil || err.Error() != "PLUGIN_MESSAGE:b line 2" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if host.current != "b" || b.cursor != strings.Index(b.content, "2") {
+		t.Errorf("Expected cursor on line 2 of b, got %s at %d", host.current, b.cursor)
+	}
+
+	// The header still goes to the first change.
+	host.current = diff.name
+	diff.cursor = 0
+	if err := plugin.ExecuteCommand("diff-goto-source"); err == nil || err.Error() != "PLUGIN_MESSAGE:b line 7" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+
+	// The blank line after the header stands for no source line.
+	host.current = diff.name
+	diff.cursor = strings.Index(diff.content, "\n\n") + 1
+	if err := plugin.ExecuteCommand("diff-goto-source"); err == nil || err.Error() != "PLUGIN_MESSAGE:No hunk at point" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	pluginsdk "github.com/TakahashiShuuhei/gmacs-plugin-sdk"
+)
+
+// diffGutterMode marks the lines of a buffer that differ from its file on
+// disk, like Emacs diff-hl-mode.
+const diffGutterMode = "diff-gutter-mode"
+
+// diffGutterOption plus a buffer name is the host option holding one marker
+// per buffer line: "" for unchanged lines or one of the gutter markers.
+const diffGutterOption = "diff-gutter:"
+
+// Gutter markers. A deletion is marked on the line that follows it, or on
+// the last line when it removed the end of the file.
+const (
+	gutterAdded   = "added"
+	gutterChanged = "changed"
+	gutterDeleted = "deleted"
+)
+
+// Host hooks that keep the gutter up to date. Their first argument is the
+// name of the buffer concerned.
+const (
+	hookAfterChange = "after-change"
+	hookAfterSave   = "after-save"
+)
+
+// savedContent returns the content of the file buffer visits, or "" when
+// the file does not exist yet.
+func savedContent(buffer pluginsdk.BufferInterface) (string, error) {
+	if buffer.Filename() == "" {
+		return "", fmt.Errorf("%s is not visiting a file", buffer.Name())
+	}
+	return fileContent(buffer.Filename())
+}
+
+// fileContent returns the content of the file at path, or "" when it does
+// not exist.
+func fileContent(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// changeHunks returns one hunk without context per change from old to new.
+func changeHunks(old, new string) []*patchHunk {
+	a := strings.Split(old, "\n")
+	b := strings.Split(new, "\n")
+	return groupHunks(diffListing(a, b, matchLinesMyers(a, b)), 0)
+}
+
+// changeSpan returns the first and last line of a change in the new
+// content, which has lineCount lines. Deletions span the line they are
+// marked on.
+func changeSpan(hunk *patchHunk, lineCount int) (int, int) {
+	if hunk.newCount == 0 {
+		line := min(hunk.newIndex(), lineCount-1)
+		return line, line
+	}
+	return hunk.newIndex(), hunk.newIndex() + hunk.newCount - 1
+}
+
+func gutterMarkers(hunks []*patchHunk, lineCount int) []string {
+	markers := make([]string, lineCount)
+	for _, hunk := range hunks {
+		first, last := changeSpan(hunk, lineCount)
+		marker := gutterChanged
+		switch {
+		case hunk.newCount == 0:
+			marker = gutterDeleted
+		case hunk.oldCount == 0:
+			marker = gutterAdded
+		}
+		for line := first; line <= last; line++ {
+			markers[line] = marker
+		}
+	}
+	return markers
+}
+
+// updateGutter recomputes and publishes the markers of buffer. It returns
+// the changes found.
+func (p *BufferDiffPlugin) updateGutter(buffer pluginsdk.BufferInterface) ([]*patchHunk, error) {
+	saved, err := savedContent(buffer)
+	if err != nil {
+		return nil, err
+	}
+	content := buffer.Content()
+	hunks := changeHunks(saved, content)
+	markers := gutterMarkers(hunks, strings.Count(content, "\n")+1)
+	if err := p.setBufferOption(diffGutterOption, buffer.Name(), markers); err != nil {
+		fmt.Printf("[PLUGIN] Failed to publish gutter of '%s': %v\n", buffer.Name(), err)
+	}
+	return hunks, nil
+}
+
+func (p *BufferDiffPlugin) gutterEnabled(bufferName string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.gutters[bufferName]
+}
+
+// gutterHook updates the gutter of the buffer a change or save hook fired
+// for.
+func (p *BufferDiffPlugin) gutterHook(args ...interface{}) error {
+	buffer := p.hookBuffer(args)
+	if buffer == nil || !p.gutterEnabled(buffer.Name()) {
+		return nil
+	}
+	_, err := p.updateGutter(buffer)
+	return err
+}
+
+// hookBuffer returns the buffer named by the first hook argument, or the
+// current buffer when the hook does not name one.
+func (p *BufferDiffPlugin) hookBuffer(args []interface{}) pluginsdk.BufferInterface {
+	if len(args) > 0 {
+		if name, ok := args[0].(string); ok {
+			return p.host.FindBuffer(name)
+		}
+	}
+	return p.host.GetCurrentBuffer()
+}
+
+// HandleDiffGutterMode toggles the diff gutter in the current buffer.
+func (p *BufferDiffPlugin) HandleDiffGutterMode() error {
+	if p.host == nil {
+		return fmt.Errorf("ERROR: host is nil")
+	}
+	buffer := p.host.GetCurrentBuffer()
+	if buffer == nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:No current buffer")
+	}
+	name := buffer.Name()
+
+	if p.gutterEnabled(name) {
+		p.disableMinorMode(name, diffGutterMode)
+		p.mu.Lock()
+		delete(p.gutters, name)
+		p.mu.Unlock()
+		p.clearBufferOptions(name, diffGutterOption)
+		return fmt.Errorf("PLUGIN_MESSAGE:Diff gutter disabled in %s", name)
+	}
+
+	hunks, err := p.updateGutter(buffer)
+	if err != nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:Cannot enable diff gutter: %v", err)
+	}
+	if !p.enableMinorMode(name, diffGutterMode) {
+		return fmt.Errorf("PLUGIN_MESSAGE:Failed to enable %s", diffGutterMode)
+	}
+
+	p.mu.Lock()
+	if p.gutters == nil {
+		p.gutters = map[string]bool{}
+	}
+	p.gutters[name] = true
+	addHooks := !p.gutterHooked
+	p.gutterHooked = true
+	p.mu.Unlock()
+	if addHooks {
+		p.host.AddHook(hookAfterChange, p.gutterHook)
+		p.host.AddHook(hookAfterSave, p.gutterHook)
+	}
+
+	return fmt.Errorf("PLUGIN_MESSAGE:Diff gutter enabled in %s: %d changes", name, len(hunks))
+}
+
+// currentChanges returns the current buffer, its lines, its changes against
+// the file on disk and the line under the cursor.
+func (p *BufferDiffPlugin) currentChanges() (pluginsdk.BufferInterface, []string, []*patchHunk, int, error) {
+	buffer := p.host.GetCurrentBuffer()
+	if buffer == nil {
+		return nil, nil, nil, 0, fmt.Errorf("PLUGIN_MESSAGE:No current buffer")
+	}
+	hunks, err := p.updateGutter(buffer)
+	if err != nil {
+		return nil, nil, nil, 0, fmt.Errorf("PLUGIN_MESSAGE:%v", err)
+	}
+	if len(hunks) == 0 {
+		return nil, nil, nil, 0, fmt.Errorf("PLUGIN_MESSAGE:No changes in %s", buffer.Name())
+	}
+	content := buffer.Content()
+	return buffer, strings.Split(content, "\n"), hunks, lineAt(content, buffer.CursorPosition()), nil
+}
+
+func (p *BufferDiffPlugin) HandleDiffGutterNext() error {
+	return p.gotoChange(true)
+}
+
+func (p *BufferDiffPlugin) HandleDiffGutterPrev() error {
+	return p.gotoChange(false)
+}
+
+func (p *BufferDiffPlugin) gotoChange(forward bool) error {
+	if p.host == nil {
+		return fmt.Errorf("ERROR: host is nil")
+	}
+	buffer, lines, hunks, line, err := p.currentChanges()
+	if err != nil {
+		return err
+	}
+
+	target := -1
+	for i, hunk := range hunks {
+		first, _ := changeSpan(hunk, len(lines))
+		if forward && first > line {
+			target = i
+			break
+		}
+		if !forward && first < line {
+			target = i
+		}
+	}
+	if target < 0 {
+		if forward {
+			return fmt.Errorf("PLUGIN_MESSAGE:No next change")
+		}
+		return fmt.Errorf("PLUGIN_MESSAGE:No previous change")
+	}
+
+	first, _ := changeSpan(hunks[target], len(lines))
+	buffer.SetCursorPosition(lineOffset(strings.Join(lines, "\n"), first))
+	return fmt.Errorf("PLUGIN_MESSAGE:Change %d of %d", target+1, len(hunks))
+}
+
+// HandleDiffGutterRevert restores the saved version of the change at point.
+func (p *BufferDiffPlugin) HandleDiffGutterRevert() error {
+	if p.host == nil {
+		return fmt.Errorf("ERROR: host is nil")
+	}
+	buffer, lines, hunks, line, err := p.currentChanges()
+	if err != nil {
+		return err
+	}
+
+	for _, hunk := range hunks {
+		first, last := changeSpan(hunk, len(lines))
+		if line < first || line > last {
+			continue
+		}
+		replaceLines(buffer, lines, hunk.newIndex(), hunk.newCount, hunk.oldLines())
+		buffer.SetCursorPosition(lineOffset(buffer.Content(), min(hunk.newIndex(), first)))
+		p.updateGutter(buffer)
+		return fmt.Errorf("PLUGIN_MESSAGE:Reverted change at line %d", first+1)
+	}
+	return fmt.Errorf("PLUGIN_MESSAGE:No change at point")
+}
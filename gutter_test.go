@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGutterMarkers(t *testing.T) {
+	hunks := changeHunks("a\nb\nc\nd\ne", "a\nB\nc\nnew\nd")
+	markers := gutterMarkers(hunks, 5)
+	expected := []string{"", gutterChanged, "", gutterAdded, gutterDeleted}
+	if !reflect.DeepEqual(markers, expected) {
+		t.Errorf("Expected %q, got %q", expected, markers)
+	}
+}
+
+func newGutterBuffer(t *testing.T, saved, content string) (*mockBuffer, *mockHost, *BufferDiffPlugin) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte(saved), 0644); err != nil {
+		t.Fatal(err)
+	}
+	buffer := &mockBuffer{name: "file.txt", content: content, filename: path}
+	host := newMockHost(buffer)
+	return buffer, host, &BufferDiffPlugin{host: host}
+}
+
+func TestDiffGutterMode(t *testing.T) {
+	buffer, host, plugin := newGutterBuffer(t, "one\ntwo\nthree", "one\nTWO\nthree")
+	option := diffGutterOption + "file.txt"
+
+	err := plugin.ExecuteCommand("diff-gutter-mode")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:Diff gutter enabled in file.txt: 1 changes" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if !reflect.DeepEqual(host.options[option], []string{"", gutterChanged, ""}) {
+		t.Errorf("Unexpected markers: %v", host.options[option])
+	}
+	if !host.minorModes["file.txt "+diffGutterMode] {
+		t.Errorf("Expected %s to be on", diffGutterMode)
+	}
+
+	// Edits are picked up through the change hook.
+	buffer.content = "one\nTWO\nthree\nfour"
+	host.TriggerHook(hookAfterChange, "file.txt")
+	if !reflect.DeepEqual(host.options[option], []string{"", gutterChanged, "", gutterAdded}) {
+		t.Errorf("Expected markers to follow the edit, got %v", host.options[option])
+	}
+
+	err = plugin.ExecuteCommand("diff-gutter-mode")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:Diff gutter disabled in file.txt" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if host.minorModes["file.txt "+diffGutterMode] {
+		t.Errorf("Expected %s to be off", diffGutterMode)
+	}
+	buffer.content = "changed"
+	host.TriggerHook(hookAfterChange, "file.txt")
+	if markers, ok := host.options[option]; ok {
+		t.Errorf("Expected the markers to be cleared once disabled, got %v", markers)
+	}
+	if len(host.hooks[hookAfterChange]) != 1 {
+		t.Errorf("Expected the hook to be added once, got %d", len(host.hooks[hookAfterChange]))
+	}
+}
+
+func TestDiffGutterNextAndRevert(t *testing.T) {
+	buffer, _, plugin := newGutterBuffer(t, "1\n2\n3\n4\n5\n6", "1\ntwo\n3\n4\n5")
+
+	if err := plugin.ExecuteCommand("diff-gutter-next"); err == nil || err.Error() != "PLUGIN_MESSAGE:Change 1 of 2" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if err := plugin.ExecuteCommand("diff-gutter-next"); err == nil || err.Error() != "PLUGIN_MESSAGE:Change 2 of 2" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if buffer.cursor != strings.Index(buffer.content, "5") {
+		t.Errorf("Expected cursor on the deletion marker, got %d", buffer.cursor)
+	}
+
+	// Line 6 was deleted at the end of the file.
+	if err := plugin.ExecuteCommand("diff-gutter-revert"); err == nil || err.Error() != "PLUGIN_MESSAGE:Reverted change at line 5" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if err := plugin.ExecuteCommand("diff-gutter-prev"); err == nil || err.Error() != "PLUGIN_MESSAGE:Change 1 of 1" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if err := plugin.ExecuteCommand("diff-gutter-revert"); err == nil || err.Error() != "PLUGIN_MESSAGE:Reverted change at line 2" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if buffer.content != "1\n2\n3\n4\n5\n6" {
+		t.Errorf("Expected the saved content back, got %q", buffer.content)
+	}
+	if err := plugin.ExecuteCommand("diff-gutter-next"); err == nil || err.Error() != "PLUGIN_MESSAGE:No changes in file.txt" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+}
+
+func TestDiffGutterModeNeedsFile(t *testing.T) {
+	plugin := &BufferDiffPlugin{host: newMockHost(&mockBuffer{name: "scratch"})}
+	err := plugin.ExecuteCommand("diff-gutter-mode")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:Cannot enable diff gutter: scratch is not visiting a file" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+}
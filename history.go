@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	pluginsdk "github.com/TakahashiShuuhei/gmacs-plugin-sdk"
+)
+
+// diffHistoryMode binds the keys of the *Diff History* buffer.
+const diffHistoryMode = "diff-history-mode"
+
+const diffHistoryBufferName = "*Diff History*"
+
+// historyHeaderLines is the number of lines before the first entry in the
+// *Diff History* buffer.
+const historyHeaderLines = 2
+
+// historyEntry is one comparison made by buffer-diff. The files let a
+// comparison be re-run after its buffers were closed.
+type historyEntry struct {
+	BufferA          string    `json:"buffer_a"`
+	BufferB          string    `json:"buffer_b"`
+	FileA            string    `json:"file_a,omitempty"`
+	FileB            string    `json:"file_b,omitempty"`
+	Algorithm        string    `json:"algorithm"`
+	IgnoreWhitespace bool      `json:"ignore_whitespace"`
+	Context          int       `json:"context"`
+	Time             time.Time `json:"time"`
+}
+
+func (e historyEntry) params() diffParams {
+	return diffParams{algorithm: e.Algorithm, ignoreWhitespace: e.IgnoreWhitespace, context: e.Context}
+}
+
+// samePair reports whether e and o compare the same two sides. A side with
+// a file on both entries is matched by the file, since a reopened file may
+// get a different buffer name.
+func (e historyEntry) samePair(o historyEntry) bool {
+	sameSide := func(name, file, otherName, otherFile string) bool {
+		if file != "" && otherFile != "" {
+			return file == otherFile
+		}
+		return name == otherName
+	}
+	return sameSide(e.BufferA, e.FileA, o.BufferA, o.FileA) && sameSide(e.BufferB, e.FileB, o.BufferB, o.FileB)
+}
+
+// describe returns the line listing e in the *Diff History* buffer.
+func (e historyEntry) describe(index int) string {
+	settings := []string{e.Algorithm}
+	if e.IgnoreWhitespace {
+		settings = append(settings, "ignoring whitespace")
+	}
+	if e.Context < 0 {
+		settings = append(settings, "full listing")
+	} else {
+		settings = append(settings, fmt.Sprintf("context %d", e.Context))
+	}
+	return fmt.Sprintf("%3d  %s  %s <-> %s  (%s)", index+1, e.Time.Format("2006-01-02 15:04"), e.BufferA, e.BufferB, strings.Join(settings, ", "))
+}
+
+// historyFile is where the history is saved.
+func (p *BufferDiffPlugin) historyFile() string {
+	def := ""
+	if dir, err := os.UserConfigDir(); err == nil {
+		def = filepath.Join(dir, "gmacs", "diff-history.json")
+	}
+	return p.stringOption("diff-history-file", def)
+}
+
+// loadHistory reads the saved history the first time it is needed. A
+// missing or unreadable file starts an empty history.
+func (p *BufferDiffPlugin) loadHistory() {
+	if p.historyLoaded {
+		return
+	}
+	p.historyLoaded = true
+	path := p.historyFile()
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Printf("[PLUGIN] Failed to read diff history %s: %v\n", path, err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &p.history); err != nil {
+		fmt.Printf("[PLUGIN] Ignoring invalid diff history %s: %v\n", path, err)
+		p.history = nil
+	}
+}
+
+func (p *BufferDiffPlugin) saveHistory() error {
+	path := p.historyFile()
+	if path == "" {
+		return fmt.Errorf("no place to save the diff history")
+	}
+	data, err := json.MarshalIndent(p.history, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// recordComparison puts the comparison of a and b first in the history,
+// replacing an earlier comparison of the same pair, and saves the history.
+// A diff-history-size of 0 or less turns the history off.
+func (p *BufferDiffPlugin) recordComparison(a, b pluginsdk.BufferInterface, params diffParams) {
+	size := p.intOption("diff-history-size", 50)
+	if size <= 0 {
+		return
+	}
+	// A snapshot is out of date by the next session; buffer-diff-with-file
+	// is quicker to run again.
+	if _, ok := p.snapshots[a.Name()]; ok {
+		return
+	}
+	p.loadHistory()
+
+	entry := historyEntry{
+		BufferA:          a.Name(),
+		BufferB:          b.Name(),
+		FileA:            a.Filename(),
+		FileB:            b.Filename(),
+		Algorithm:        params.algorithm,
+		IgnoreWhitespace: params.ignoreWhitespace,
+		Context:          params.context,
+		Time:             time.Now(),
+	}
+	history := []historyEntry{entry}
+	for _, e := range p.history {
+		if !e.samePair(entry) {
+			history = append(history, e)
+		}
+	}
+	p.history = history[:min(len(history), size)]
+
+	if err := p.saveHistory(); err != nil {
+		fmt.Printf("[PLUGIN] Failed to save diff history: %v\n", err)
+	}
+}
+
+// HandleBufferDiffHistory lists the recorded comparisons, most recent first,
+// in the *Diff History* buffer.
+func (p *BufferDiffPlugin) HandleBufferDiffHistory() error {
+	if p.host == nil {
+		return fmt.Errorf("ERROR: host is nil")
+	}
+	p.loadHistory()
+	if len(p.history) == 0 {
+		return fmt.Errorf("PLUGIN_MESSAGE:No comparisons in history")
+	}
+
+	lines := []string{"Recent comparisons (RET re-runs the comparison at point)", ""}
+	for i, entry := range p.history {
+		lines = append(lines, entry.describe(i))
+	}
+	// Re-running moves entries in the history, so RET goes by what is shown.
+	p.historyListing = append([]historyEntry(nil), p.history...)
+
+	buffer := p.host.FindBuffer(diffHistoryBufferName)
+	if buffer == nil {
+		buffer = p.host.CreateBuffer(diffHistoryBufferName)
+		if buffer == nil {
+			return fmt.Errorf("PLUGIN_MESSAGE:Failed to create history buffer")
+		}
+	}
+	content := strings.Join(lines, "\n")
+	buffer.SetContent(content)
+	buffer.SetCursorPosition(lineOffset(content, historyHeaderLines))
+	p.enableMinorMode(diffHistoryBufferName, diffHistoryMode)
+
+	if err := p.host.SwitchToBuffer(diffHistoryBufferName); err != nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:Failed to switch to history buffer: %v", err)
+	}
+	return fmt.Errorf("PLUGIN_MESSAGE:%d comparisons in history", len(p.history))
+}
+
+// HandleDiffHistoryRerun compares again the pair listed on the line at
+// point, with the settings it was compared with. Buffers that were closed
+// are reopened from their files.
+func (p *BufferDiffPlugin) HandleDiffHistoryRerun() error {
+	if p.host == nil {
+		return fmt.Errorf("ERROR: host is nil")
+	}
+	buffer := p.host.GetCurrentBuffer()
+	if buffer == nil || buffer.Name() != diffHistoryBufferName {
+		return fmt.Errorf("PLUGIN_MESSAGE:Not in %s", diffHistoryBufferName)
+	}
+	index := lineAt(buffer.Content(), buffer.CursorPosition()) - historyHeaderLines
+	if index < 0 || index >= len(p.historyListing) {
+		return fmt.Errorf("PLUGIN_MESSAGE:No comparison at point")
+	}
+	entry := p.historyListing[index]
+
+	nameA, err := p.historyBuffer(entry.BufferA, entry.FileA)
+	if err != nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:%v", err)
+	}
+	nameB, err := p.historyBuffer(entry.BufferB, entry.FileB)
+	if err != nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:%v", err)
+	}
+	return p.compareBuffers(nameA, nameB, entry.params())
+}
+
+// historyBuffer returns the name of the buffer to compare for one side of a
+// history entry. A buffer of that name is reused only while it still visits
+// the recorded file; otherwise the file is opened.
+func (p *BufferDiffPlugin) historyBuffer(name, file string) (string, error) {
+	if buffer := p.host.FindBuffer(name); buffer != nil && (file == "" || buffer.Filename() == file) {
+		return name, nil
+	}
+	if file == "" {
+		return "", fmt.Errorf("Buffer not found: %s", name)
+	}
+	buffer, err := p.openFileBuffer(file)
+	if err != nil {
+		return "", fmt.Errorf("Cannot reopen %s: %v", file, err)
+	}
+	return buffer.Name(), nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiffHistory(t *testing.T) {
+	dir := t.TempDir()
+	pathA := filepath.Join(dir, "generated.txt")
+	pathB := filepath.Join(dir, "expected.txt")
+	os.WriteFile(pathA, []byte("one\ntwo"), 0644)
+	os.WriteFile(pathB, []byte("one\nTWO"), 0644)
+
+	host := newMockHost(
+		&mockBuffer{name: "generated.txt", content: "one\ntwo", filename: pathA},
+		&mockBuffer{name: "expected.txt", content: "one\nTWO", filename: pathB},
+	)
+	historyFile := filepath.Join(dir, "history", "diff-history.json")
+	host.options["diff-history-size"] = 50
+	host.options["diff-history-file"] = historyFile
+	plugin := &BufferDiffPlugin{host: host}
+
+	host.options["diff-algorithm"] = "patience"
+	plugin.ExecuteCommand("buffer-diff", "generated.txt", "expected.txt")
+	host.options["diff-algorithm"] = "myers"
+	plugin.ExecuteCommand("buffer-diff", "expected.txt", "generated.txt")
+	host.options["diff-context"] = 2
+	plugin.ExecuteCommand("buffer-diff", "generated.txt", "expected.txt")
+
+	if len(plugin.history) != 2 {
+		t.Fatalf("Expected 2 history entries, got %d", len(plugin.history))
+	}
+	if _, err := os.Stat(historyFile); err != nil {
+		t.Fatalf("Expected the history to be saved: %v", err)
+	}
+
+	// A new session reads the saved history.
+	delete(host.buffers, "generated.txt")
+	host.options["diff-algorithm"] = "patience"
+	plugin = &BufferDiffPlugin{host: host}
+	err := plugin.ExecuteCommand("buffer-diff-history")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:2 comparisons in history" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	list := host.buffers[diffHistoryBufferName]
+	lines := strings.Split(list.content, "\n")
+	if len(lines) != historyHeaderLines+2 {
+		t.Fatalf("Expected 2 entries listed, got %q", list.content)
+	}
+	if !strings.HasSuffix(lines[2], "generated.txt <-> expected.txt  (myers, context 2)") {
+		t.Errorf("Unexpected first entry: %q", lines[2])
+	}
+	if !strings.HasSuffix(lines[3], "expected.txt <-> generated.txt  (myers, full listing)") {
+		t.Errorf("Unexpected second entry: %q", lines[3])
+	}
+	if host.current != diffHistoryBufferName || list.cursor != lineOffset(list.content, 2) {
+		t.Errorf("Expected the cursor on the first entry of %s", diffHistoryBufferName)
+	}
+
+	// Re-running reopens the closed buffer and uses the recorded settings,
+	// not the current options.
+	err = plugin.ExecuteCommand("diff-history-rerun")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:Buffer diff completed: 1 differences found, first at line 2 of "+pathA+" and line 2 of expected.txt" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	diffName := "*Diff: " + pathA + " <-> expected.txt*"
+	diff := host.buffers[diffName]
+	if diff == nil || !strings.HasPrefix(diff.content, "--- "+pathA+"\n+++ expected.txt\n@@ -1,2 +1,2 @@") {
+		t.Errorf("Expected a diff with context from the reopened file, got %v", diff)
+	}
+	if s := plugin.sessions[diffName]; s == nil || s.params.algorithm != "myers" || s.params.context != 2 {
+		t.Errorf("Expected the recorded settings to be used")
+	}
+	// The reopened buffer has another name, but the same files: the entry
+	// is replaced, not duplicated.
+	if len(plugin.history) != 2 || plugin.history[0].BufferA != pathA {
+		t.Errorf("Expected the re-run to replace its entry, got %+v", plugin.history)
+	}
+
+	host.current = diffHistoryBufferName
+	list.cursor = 0
+	if err := plugin.ExecuteCommand("diff-history-rerun"); err == nil || err.Error() != "PLUGIN_MESSAGE:No comparison at point" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+}
+
+func TestDiffHistoryRerunChecksBufferFile(t *testing.T) {
+	dir := t.TempDir()
+	pathA := filepath.Join(dir, "a", "main.go")
+	pathB := filepath.Join(dir, "b", "main.go")
+	os.MkdirAll(filepath.Dir(pathA), 0755)
+	os.MkdirAll(filepath.Dir(pathB), 0755)
+	os.WriteFile(pathA, []byte("one\ntwo"), 0644)
+	os.WriteFile(pathB, []byte("one\nTWO"), 0644)
+
+	host := newMockHost(
+		&mockBuffer{name: "main.go", content: "one\ntwo", filename: pathA},
+		&mockBuffer{name: "main.go<2>", content: "one\nTWO", filename: pathB},
+	)
+	host.options["diff-history-size"] = 50
+	host.options["diff-history-file"] = filepath.Join(dir, "diff-history.json")
+	plugin := &BufferDiffPlugin{host: host}
+	plugin.ExecuteCommand("buffer-diff", "main.go", "main.go<2>")
+
+	// main.go now names a buffer visiting another file.
+	other := filepath.Join(dir, "other.go")
+	os.WriteFile(other, []byte("unrelated"), 0644)
+	host.buffers["main.go"] = &mockBuffer{name: "main.go", content: "unrelated", filename: other}
+
+	plugin.ExecuteCommand("buffer-diff-history")
+	err := plugin.ExecuteCommand("diff-history-rerun")
+	if err == nil || !strings.Contains(err.Error(), "first at line 2 of "+pathA+" and line 2 of main.go<2>") {
+		t.Errorf("Expected the recorded file to be opened, got %v", err)
+	}
+	if s := plugin.sessions["*Diff: "+pathA+" <-> main.go<2>*"]; s == nil || s.bufferA != pathA {
+		t.Errorf("Expected a session comparing %s, got %+v", pathA, plugin.sessions)
+	}
+}
+
+func TestDiffHistoryDisabled(t *testing.T) {
+	host := newMockHost(&mockBuffer{name: "a"}, &mockBuffer{name: "b"})
+	plugin := &BufferDiffPlugin{host: host}
+
+	plugin.ExecuteCommand("buffer-diff", "a", "b")
+	if err := plugin.ExecuteCommand("buffer-diff-history"); err == nil || err.Error() != "PLUGIN_MESSAGE:No comparisons in history" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+}
+
+func TestDiffHistoryRerunFollowsListing(t *testing.T) {
+	host := newMockHost(&mockBuffer{name: "a"}, &mockBuffer{name: "b"}, &mockBuffer{name: "c"}, &mockBuffer{name: "d"})
+	host.options["diff-history-size"] = 50
+	host.options["diff-history-file"] = filepath.Join(t.TempDir(), "diff-history.json")
+	plugin := &BufferDiffPlugin{host: host}
+
+	plugin.ExecuteCommand("buffer-diff", "a", "b")
+	plugin.ExecuteCommand("buffer-diff", "c", "d")
+	plugin.ExecuteCommand("buffer-diff-history")
+	list := host.buffers[diffHistoryBufferName]
+
+	// Re-running the second row moves it to the front of the history, but
+	// the listing still shows it second.
+	for i := 0; i < 2; i++ {
+		host.current = diffHistoryBufferName
+		list.cursor = lineOffset(list.content, historyHeaderLines+1)
+		plugin.ExecuteCommand("diff-history-rerun")
+		if host.current != "*Diff: a <-> b*" {
+			t.Errorf("Re-run %d: expected a and b to be compared, got %s", i+1, host.current)
+		}
+	}
+	if plugin.history[0].BufferA != "a" {
+		t.Errorf("Expected a and b first in the history, got %+v", plugin.history[0])
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Conflict markers written by buffer-merge3, in diff3 style.
+const (
+	markerMine   = "<<<<<<<"
+	markerBase   = "|||||||"
+	markerSep    = "======="
+	markerTheirs = ">>>>>>>"
+)
+
+// mergeRegion is a run of the merge result. Resolved regions carry their
+// lines in resolved; conflicting ones carry all three versions.
+type mergeRegion struct {
+	conflict bool
+	resolved []string
+	mine     []string
+	base     []string
+	theirs   []string
+}
+
+// merge3 merges mine and theirs, both derived from base. Regions where only
+// one side changed, or both made the same change, are resolved; the rest are
+// returned as conflicts.
+func merge3(mine, base, theirs []string) []mergeRegion {
+	toMine := matchLinesMyers(base, mine)
+	toTheirs := matchLinesMyers(base, theirs)
+
+	var regions []mergeRegion
+	emit := func(lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		if n := len(regions); n > 0 && !regions[n-1].conflict {
+			regions[n-1].resolved = append(regions[n-1].resolved, lines...)
+			return
+		}
+		regions = append(regions, mergeRegion{resolved: append([]string(nil), lines...)})
+	}
+
+	i, a, b := 0, 0, 0
+	for i < len(base) || a < len(mine) || b < len(theirs) {
+		if i < len(base) && toMine[i] == a && toTheirs[i] == b {
+			emit(base[i : i+1])
+			i, a, b = i+1, a+1, b+1
+			continue
+		}
+
+		// The unstable chunk runs up to the next base line kept by both sides.
+		j := i
+		for j < len(base) && (toMine[j] < 0 || toTheirs[j] < 0) {
+			j++
+		}
+		aEnd, bEnd := len(mine), len(theirs)
+		if j < len(base) {
+			aEnd, bEnd = toMine[j], toTheirs[j]
+		}
+
+		baseChunk, mineChunk, theirsChunk := base[i:j], mine[a:aEnd], theirs[b:bEnd]
+		switch {
+		case equalLines(mineChunk, baseChunk):
+			emit(theirsChunk)
+		case equalLines(theirsChunk, baseChunk), equalLines(mineChunk, theirsChunk):
+			emit(mineChunk)
+		default:
+			regions = append(regions, mergeRegion{
+				conflict: true,
+				mine:     mineChunk,
+				base:     baseChunk,
+				theirs:   theirsChunk,
+			})
+		}
+		i, a, b = j, aEnd, bEnd
+	}
+	return regions
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// formatMerge renders merge regions with diff3-style conflict markers
+// labelled with the buffer names.
+func formatMerge(regions []mergeRegion, mineName, baseName, theirsName string) []string {
+	var lines []string
+	for _, r := range regions {
+		if !r.conflict {
+			lines = append(lines, r.resolved...)
+			continue
+		}
+		lines = append(lines, markerMine+" "+mineName)
+		lines = append(lines, r.mine...)
+		lines = append(lines, markerBase+" "+baseName)
+		lines = append(lines, r.base...)
+		lines = append(lines, markerSep)
+		lines = append(lines, r.theirs...)
+		lines = append(lines, markerTheirs+" "+theirsName)
+	}
+	return lines
+}
+
+func countConflicts(regions []mergeRegion) int {
+	count := 0
+	for _, r := range regions {
+		if r.conflict {
+			count++
+		}
+	}
+	return count
+}
+
+func (p *BufferDiffPlugin) HandleBufferMerge3(mineName, baseName, theirsName string) error {
+	if p.host == nil {
+		return fmt.Errorf("ERROR: host is nil")
+	}
+
+	var contents []string
+	for _, name := range []string{mineName, baseName, theirsName} {
+		buffer := p.host.FindBuffer(name)
+		if buffer == nil {
+			return fmt.Errorf("PLUGIN_MESSAGE:Buffer not found: %s", name)
+		}
+		contents = append(contents, buffer.Content())
+	}
+
+	regions := merge3(
+		strings.Split(contents[0], "\n"),
+		strings.Split(contents[1], "\n"),
+		strings.Split(contents[2], "\n"),
+	)
+	merged := formatMerge(regions, mineName, baseName, theirsName)
+
+	mergeBufferName := fmt.Sprintf("*Merge: %s <-> %s*", mineName, theirsName)
+	mergeBuffer := p.host.FindBuffer(mergeBufferName)
+	if mergeBuffer == nil {
+		mergeBuffer = p.host.CreateBuffer(mergeBufferName)
+		if mergeBuffer == nil {
+			return fmt.Errorf("PLUGIN_MESSAGE:Failed to create merge buffer")
+		}
+	}
+	mergeBuffer.SetContent(strings.Join(merged, "\n"))
+	p.enableMinorMode(mergeBufferName, mergeConflictMode)
+
+	if err := p.host.SwitchToBuffer(mergeBufferName); err != nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:Failed to switch to merge buffer: %v", err)
+	}
+
+	return fmt.Errorf("PLUGIN_MESSAGE:Merge completed: %d conflicts", countConflicts(regions))
+}
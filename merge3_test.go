@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMerge3(t *testing.T) {
+	base := strings.Fields("a b c d e f")
+	mine := strings.Fields("a B c d e f g")
+	theirs := strings.Fields("a b c D e f g")
+
+	regions := merge3(mine, base, theirs)
+	if n := countConflicts(regions); n != 0 {
+		t.Fatalf("Expected no conflicts, got %d", n)
+	}
+	got := strings.Join(formatMerge(regions, "mine", "base", "theirs"), " ")
+	if got != "a B c D e f g" {
+		t.Errorf("Unexpected merge: %s", got)
+	}
+}
+
+func TestMerge3Conflict(t *testing.T) {
+	base := strings.Fields("a b c")
+	mine := strings.Fields("a x c")
+	theirs := strings.Fields("a y c")
+
+	regions := merge3(mine, base, theirs)
+	if n := countConflicts(regions); n != 1 {
+		t.Fatalf("Expected 1 conflict, got %d", n)
+	}
+	expected := "a\n<<<<<<< m\nx\n||||||| o\nb\n=======\ny\n>>>>>>> t\nc"
+	if got := strings.Join(formatMerge(regions, "m", "o", "t"), "\n"); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestHandleBufferMerge3(t *testing.T) {
+	host := newMockHost(
+		&mockBuffer{name: "mine", content: "one\ntwo\nthree\n"},
+		&mockBuffer{name: "base", content: "one\n2\nthree\n"},
+		&mockBuffer{name: "theirs", content: "one\nzwei\nthree\nfour\n"},
+	)
+	plugin := &BufferDiffPlugin{host: host}
+
+	err := plugin.ExecuteCommand("buffer-merge3", "mine", "base", "theirs")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:Merge completed: 1 conflicts" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	merged := host.FindBuffer("*Merge: mine <-> theirs*")
+	if merged == nil {
+		t.Fatal("Expected merge buffer to be created")
+	}
+	expected := "one\n<<<<<<< mine\ntwo\n||||||| base\n2\n=======\nzwei\n>>>>>>> theirs\nthree\nfour\n"
+	if merged.Content() != expected {
+		t.Errorf("Expected %q, got %q", expected, merged.Content())
+	}
+	if host.current != "*Merge: mine <-> theirs*" {
+		t.Errorf("Expected to switch to the merge buffer, current is %s", host.current)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// intOption reads an integer option from the host, falling back to def when
+// the option is unset or not a number.
+func (p *BufferDiffPlugin) intOption(name string, def int) int {
+	if p.host == nil {
+		return def
+	}
+	value, err := p.host.GetOption(name)
+	if err != nil || value == nil {
+		return def
+	}
+	switch v := value.(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	case string:
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	fmt.Printf("[PLUGIN] Option %s has unexpected value %v, using %d\n", name, value, def)
+	return def
+}
+
+// boolOption reads a boolean option from the host, falling back to def when
+// the option is unset or not a boolean.
+func (p *BufferDiffPlugin) boolOption(name string, def bool) bool {
+	if p.host == nil {
+		return def
+	}
+	value, err := p.host.GetOption(name)
+	if err != nil || value == nil {
+		return def
+	}
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	fmt.Printf("[PLUGIN] Option %s has unexpected value %v, using %v\n", name, value, def)
+	return def
+}
+
+// stringOption reads a string option from the host, falling back to def
+// when the option is unset or empty.
+func (p *BufferDiffPlugin) stringOption(name string, def string) string {
+	if p.host == nil {
+		return def
+	}
+	value, err := p.host.GetOption(name)
+	if err != nil || value == nil {
+		return def
+	}
+	s, ok := value.(string)
+	if !ok {
+		fmt.Printf("[PLUGIN] Option %s has unexpected value %v, using %s\n", name, value, def)
+		return def
+	}
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// Option kinds of optionSpec.
+const (
+	optionInt    = "int"
+	optionBool   = "bool"
+	optionString = "string"
+)
+
+// optionSpec describes a host option the plugin reads, for diff-set-option
+// and its completions.
+type optionSpec struct {
+	name string
+	kind string
+	// values lists the accepted values of a string option; any value is
+	// accepted when it is empty.
+	values []string
+}
+
+var pluginOptions = []optionSpec{
+	{name: "compare-ignore-whitespace", kind: optionBool},
+	{name: "diff-algorithm", kind: optionString, values: []string{algorithmMyers, algorithmPatience}},
+	{name: "diff-auto-refresh", kind: optionBool},
+	{name: "diff-collapse-unchanged", kind: optionInt},
+	{name: "diff-context", kind: optionInt},
+	{name: "diff-history-file", kind: optionString},
+	{name: "diff-history-size", kind: optionInt},
+	{name: "diff-ignore-whitespace", kind: optionBool},
+	{name: "diff-move-source-cursors", kind: optionBool},
+	{name: "diff-watch-delay", kind: optionInt},
+	{name: "patch-fuzz", kind: optionInt},
+	{name: "patch-max-offset", kind: optionInt},
+}
+
+func findOption(name string) (optionSpec, bool) {
+	for _, spec := range pluginOptions {
+		if spec.name == name {
+			return spec, true
+		}
+	}
+	return optionSpec{}, false
+}
+
+// optionValues returns the values a value prompt offers for spec.
+func (spec optionSpec) optionValues() []string {
+	if spec.kind == optionBool {
+		return []string{"false", "true"}
+	}
+	return spec.values
+}
+
+// parse converts text typed at a prompt into the option's value.
+func (spec optionSpec) parse(text string) (interface{}, error) {
+	switch spec.kind {
+	case optionInt:
+		n, err := strconv.Atoi(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a number", spec.name)
+		}
+		return n, nil
+	case optionBool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be true or false", spec.name)
+		}
+		return b, nil
+	}
+	if len(spec.values) == 0 {
+		return text, nil
+	}
+	for _, v := range spec.values {
+		if v == text {
+			return text, nil
+		}
+	}
+	return nil, fmt.Errorf("%s must be one of: %s", spec.name, strings.Join(spec.values, ", "))
+}
+
+// HandleDiffSetOption sets one of the options the plugin reads, checking its
+// value first.
+func (p *BufferDiffPlugin) HandleDiffSetOption(name, text string) error {
+	if p.host == nil {
+		return fmt.Errorf("ERROR: host is nil")
+	}
+	spec, ok := findOption(name)
+	if !ok {
+		return fmt.Errorf("PLUGIN_MESSAGE:Unknown option: %s", name)
+	}
+	value, err := spec.parse(text)
+	if err != nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:%v", err)
+	}
+	if err := p.host.SetOption(name, value); err != nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:Failed to set %s: %v", name, err)
+	}
+	return fmt.Errorf("PLUGIN_MESSAGE:%s set to %v", name, value)
+}
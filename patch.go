@@ -0,0 +1,740 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// patchLine is a single body line of a hunk. bufLine is the line index in the
+// buffer the patch was parsed from, or -1 for lines built in memory.
+type patchLine struct {
+	op      byte // ' ', '-' or '+'
+	text    string
+	bufLine int
+}
+
+// patchHunk is one hunk of a unified diff. The start/count fields follow the
+// unified header convention: a start of N with a count of 0 means "after line N".
+type patchHunk struct {
+	oldStart, oldCount int
+	newStart, newCount int
+	section            string
+	headerLine         int // buffer line of the @@ header, -1 when synthesized
+	lines              []patchLine
+}
+
+// filePatch holds the hunks that apply to a single file. created and deleted
+// are set for git "new file"/"deleted file" entries and for /dev/null names.
+type filePatch struct {
+	oldName    string
+	newName    string
+	created    bool
+	deleted    bool
+	headerLine int // buffer line of the "diff --git" or --- line, -1 without a header
+	hunks      []*patchHunk
+	listing    []patchLine // every line of a full buffer-diff listing, nil for @@ hunks
+}
+
+// devNull is the file name diff uses for the missing side of a created or
+// deleted file.
+const devNull = "/dev/null"
+
+// hunkResult reports the outcome of applying one hunk.
+type hunkResult struct {
+	index   int // 1-based hunk number
+	applied bool
+	line    int // 1-based target line the hunk was applied at
+	offset  int // lines between the recorded and the actual position
+	fuzz    int // context lines ignored to make the hunk match
+	reason  string
+}
+
+// listingContext is the number of context lines kept around changes when a
+// full listing (as produced by buffer-diff) is parsed into hunks.
+const listingContext = 3
+
+func (h *patchHunk) oldIndex() int {
+	if h.oldCount == 0 {
+		return h.oldStart
+	}
+	return h.oldStart - 1
+}
+
+func (h *patchHunk) newIndex() int {
+	if h.newCount == 0 {
+		return h.newStart
+	}
+	return h.newStart - 1
+}
+
+// oldLines returns the lines the hunk expects to find in the target.
+func (h *patchHunk) oldLines() []string {
+	var lines []string
+	for _, l := range h.lines {
+		if l.op != '+' {
+			lines = append(lines, l.text)
+		}
+	}
+	return lines
+}
+
+// newLines returns the lines the hunk leaves behind in the target.
+func (h *patchHunk) newLines() []string {
+	var lines []string
+	for _, l := range h.lines {
+		if l.op != '-' {
+			lines = append(lines, l.text)
+		}
+	}
+	return lines
+}
+
+func (h *patchHunk) header() string {
+	header := fmt.Sprintf("@@ -%s +%s @@", formatRange(h.oldStart, h.oldCount), formatRange(h.newStart, h.newCount))
+	if h.section != "" {
+		header += " " + h.section
+	}
+	return header
+}
+
+func formatRange(start, count int) string {
+	if count == 1 {
+		return strconv.Itoa(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// parsePatch parses unified diff text into per-file patches. Besides regular
+// @@ hunks it accepts the full listing written by buffer-diff, where every
+// line of both buffers follows the ---/+++ header without hunk headers.
+func parsePatch(text string) ([]*filePatch, error) {
+	lines := strings.Split(text, "\n")
+	var files []*filePatch
+	var current *filePatch
+	// gitSection is set between a "diff --git" line and its first hunk, where
+	// the ---/+++ header belongs to the file that line started.
+	gitSection := false
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		if strings.HasPrefix(line, "diff --git ") {
+			oldName, newName := gitFileNames(line[len("diff --git "):])
+			current = &filePatch{oldName: oldName, newName: newName, headerLine: i}
+			files = append(files, current)
+			gitSection = true
+			continue
+		}
+		if gitSection {
+			switch {
+			case strings.HasPrefix(line, "new file mode"):
+				current.created = true
+			case strings.HasPrefix(line, "deleted file mode"):
+				current.deleted = true
+			}
+		}
+
+		if strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ") {
+			if !gitSection {
+				current = &filePatch{headerLine: i}
+				files = append(files, current)
+			}
+			gitSection = false
+			current.oldName = patchFileName(line[4:])
+			current.newName = patchFileName(lines[i+1][4:])
+			current.created = current.created || current.oldName == devNull
+			current.deleted = current.deleted || current.newName == devNull
+			i++
+
+			if listingFollows(lines, i+1) {
+				start := i + 1
+				if lines[start] == "" {
+					start++
+				}
+				end := start
+				for end < len(lines) && !isFileHeader(lines, end) && !strings.HasPrefix(lines[end], "diff --git ") {
+					end++
+				}
+				listing, err := parseListing(lines, start, end)
+				if err != nil {
+					return nil, err
+				}
+				current.listing = listing
+				current.hunks = groupHunks(listing, listingContext)
+				i = end - 1
+			}
+			continue
+		}
+
+		if strings.HasPrefix(line, "@@ ") {
+			gitSection = false
+			if current == nil {
+				current = &filePatch{headerLine: -1}
+				files = append(files, current)
+			}
+			hunk, next, err := parseHunk(lines, i)
+			if err != nil {
+				return nil, err
+			}
+			current.hunks = append(current.hunks, hunk)
+			i = next - 1
+		}
+		// Anything else between hunks (commit messages, index lines,
+		// comments) is ignored, as GNU patch does.
+	}
+
+	return files, nil
+}
+
+// patchFileName strips the timestamp that diff appends to ---/+++ headers.
+func patchFileName(field string) string {
+	if tab := strings.IndexByte(field, '\t'); tab >= 0 {
+		field = field[:tab]
+	}
+	return strings.TrimSpace(field)
+}
+
+// gitFileNames splits the "a/old b/new" part of a "diff --git" line. Names
+// containing spaces are ambiguous there; the ---/+++ header that usually
+// follows replaces them.
+func gitFileNames(field string) (string, string) {
+	if i := strings.Index(field, " b/"); i >= 0 {
+		return field[:i], field[i+1:]
+	}
+	oldName, newName, _ := strings.Cut(field, " ")
+	return oldName, newName
+}
+
+func isFileHeader(lines []string, i int) bool {
+	return strings.HasPrefix(lines[i], "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ")
+}
+
+// listingFollows reports whether the file header ending just before line i is
+// followed by a full listing rather than @@ hunks.
+func listingFollows(lines []string, i int) bool {
+	if i < len(lines) && lines[i] == "" {
+		i++
+	}
+	if i >= len(lines) {
+		return false
+	}
+	line := lines[i]
+	if strings.HasPrefix(line, "@@ ") || isFileHeader(lines, i) {
+		return false
+	}
+	if _, ok := placeholderCount(line); ok {
+		return true
+	}
+	return line != "" && strings.ContainsRune(" -+", rune(line[0]))
+}
+
+// parseListing parses listing lines[start:end]. A placeholder left by
+// collapsing unchanged lines stands for that many unchanged lines, all at
+// its buffer line; their text is not known.
+func parseListing(lines []string, start, end int) ([]patchLine, error) {
+	var listing []patchLine
+	for i := start; i < end; i++ {
+		line := lines[i]
+		if n, ok := placeholderCount(line); ok {
+			for range n {
+				listing = append(listing, patchLine{op: ' ', bufLine: i})
+			}
+			continue
+		}
+		if line == "" {
+			// A trailing empty line is the end of the buffer, not a diff line.
+			if i == end-1 {
+				break
+			}
+			return nil, fmt.Errorf("line %d: empty line in diff listing", i+1)
+		}
+		if !strings.ContainsRune(" -+", rune(line[0])) {
+			return nil, fmt.Errorf("line %d: unexpected diff line: %s", i+1, line)
+		}
+		listing = append(listing, patchLine{op: line[0], text: line[1:], bufLine: i})
+	}
+	return listing, nil
+}
+
+// parseHunk parses the hunk whose @@ header is at lines[start] and returns it
+// together with the index of the first line after its body.
+func parseHunk(lines []string, start int) (*patchHunk, int, error) {
+	hunk, err := parseHunkHeader(lines[start])
+	if err != nil {
+		return nil, 0, fmt.Errorf("line %d: %v", start+1, err)
+	}
+	hunk.headerLine = start
+
+	oldLeft, newLeft := hunk.oldCount, hunk.newCount
+	i := start + 1
+	for ; i < len(lines) && (oldLeft > 0 || newLeft > 0); i++ {
+		line := lines[i]
+		op := byte(' ')
+		text := ""
+		if line != "" {
+			op = line[0]
+			text = line[1:]
+		}
+		switch op {
+		case ' ':
+			oldLeft--
+			newLeft--
+		case '-':
+			oldLeft--
+		case '+':
+			newLeft--
+		case '\\':
+			// "\ No newline at end of file"
+			continue
+		default:
+			return nil, 0, fmt.Errorf("line %d: unexpected line in hunk: %s", i+1, line)
+		}
+		if oldLeft < 0 || newLeft < 0 {
+			return nil, 0, fmt.Errorf("line %d: hunk body does not match header %s", i+1, lines[start])
+		}
+		hunk.lines = append(hunk.lines, patchLine{op: op, text: text, bufLine: i})
+	}
+	if oldLeft > 0 || newLeft > 0 {
+		return nil, 0, fmt.Errorf("line %d: hunk is truncated", start+1)
+	}
+	for i < len(lines) && strings.HasPrefix(lines[i], "\\") {
+		i++
+	}
+	return hunk, i, nil
+}
+
+func parseHunkHeader(line string) (*patchHunk, error) {
+	fields := strings.SplitN(line, "@@", 3)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("malformed hunk header: %s", line)
+	}
+	ranges := strings.Fields(fields[1])
+	if len(ranges) != 2 || !strings.HasPrefix(ranges[0], "-") || !strings.HasPrefix(ranges[1], "+") {
+		return nil, fmt.Errorf("malformed hunk header: %s", line)
+	}
+	hunk := &patchHunk{section: strings.TrimSpace(fields[2])}
+	var err error
+	if hunk.oldStart, hunk.oldCount, err = parseRange(ranges[0][1:]); err != nil {
+		return nil, fmt.Errorf("malformed hunk header: %s", line)
+	}
+	if hunk.newStart, hunk.newCount, err = parseRange(ranges[1][1:]); err != nil {
+		return nil, fmt.Errorf("malformed hunk header: %s", line)
+	}
+	return hunk, nil
+}
+
+func parseRange(s string) (int, int, error) {
+	startText, countText, hasCount := strings.Cut(s, ",")
+	start, err := strconv.Atoi(startText)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !hasCount {
+		return start, 1, nil
+	}
+	count, err := strconv.Atoi(countText)
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, count, nil
+}
+
+// groupHunks splits a full listing into hunks that keep up to context
+// unchanged lines around each change. A negative context yields one hunk
+// covering the whole listing.
+func groupHunks(listing []patchLine, context int) []*patchHunk {
+	var changes []int
+	for i, l := range listing {
+		if l.op != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	if context < 0 {
+		return []*patchHunk{newHunk(listing, 0, len(listing), 0, 0)}
+	}
+
+	// Line numbers on each side at every listing index.
+	oldAt := make([]int, len(listing)+1)
+	newAt := make([]int, len(listing)+1)
+	for i, l := range listing {
+		oldAt[i+1], newAt[i+1] = oldAt[i], newAt[i]
+		if l.op != '+' {
+			oldAt[i+1]++
+		}
+		if l.op != '-' {
+			newAt[i+1]++
+		}
+	}
+
+	var hunks []*patchHunk
+	start := max(changes[0]-context, 0)
+	end := changes[0] + 1
+	for _, c := range changes[1:] {
+		if c-end > 2*context {
+			stop := min(end+context, len(listing))
+			hunks = append(hunks, newHunk(listing, start, stop, oldAt[start], newAt[start]))
+			start = c - context
+		}
+		end = c + 1
+	}
+	stop := min(end+context, len(listing))
+	hunks = append(hunks, newHunk(listing, start, stop, oldAt[start], newAt[start]))
+	return hunks
+}
+
+// newHunk builds a hunk from listing[start:end], whose first line sits at
+// 0-based index oldIndex/newIndex on each side.
+func newHunk(listing []patchLine, start, end, oldIndex, newIndex int) *patchHunk {
+	hunk := &patchHunk{headerLine: -1}
+	hunk.lines = append(hunk.lines, listing[start:end]...)
+	for _, l := range hunk.lines {
+		if l.op != '+' {
+			hunk.oldCount++
+		}
+		if l.op != '-' {
+			hunk.newCount++
+		}
+	}
+	hunk.oldStart = oldIndex + 1
+	if hunk.oldCount == 0 {
+		hunk.oldStart = oldIndex
+	}
+	hunk.newStart = newIndex + 1
+	if hunk.newCount == 0 {
+		hunk.newStart = newIndex
+	}
+	return hunk
+}
+
+// applyOptions controls how far applyHunks may stray from the line numbers
+// recorded in a hunk.
+type applyOptions struct {
+	maxOffset int // lines to search either side of the expected position, -1 for no limit
+	fuzz      int // outer context lines that may be ignored, as in GNU patch
+}
+
+// exactApply only accepts hunks at their recorded position.
+var exactApply = applyOptions{}
+
+// applyHunks applies hunks in order to lines and returns the patched lines
+// together with a result per hunk. Hunks that do not match are skipped, so
+// the caller decides whether a partial result is acceptable.
+func applyHunks(lines []string, hunks []*patchHunk, opts applyOptions) ([]string, []hunkResult) {
+	result := append([]string(nil), lines...)
+	results := make([]hunkResult, 0, len(hunks))
+	delta := 0
+
+	for i, hunk := range hunks {
+		expected := hunk.oldIndex() + delta
+		pos, head, tail, fuzz, ok := locateHunk(result, hunk, expected, opts)
+		if !ok {
+			// Report the mismatch at the recorded position.
+			mismatch := matchLines(result, expected, hunk.oldLines())
+			results = append(results, hunkResult{
+				index:  i + 1,
+				reason: mismatchReason(result, mismatch),
+			})
+			continue
+		}
+
+		old := trimContext(hunk.lines, head, tail)
+		var removed, added []string
+		for _, l := range old {
+			if l.op != '+' {
+				removed = append(removed, l.text)
+			}
+			if l.op != '-' {
+				added = append(added, l.text)
+			}
+		}
+		start := pos + head
+		result = append(result[:start], append(added, result[start+len(removed):]...)...)
+		delta = pos - hunk.oldIndex() + len(added) - len(removed)
+		results = append(results, hunkResult{
+			index:   i + 1,
+			applied: true,
+			line:    pos + 1,
+			offset:  pos - expected,
+			fuzz:    fuzz,
+		})
+	}
+
+	return result, results
+}
+
+// locateHunk searches for the position of hunk's old lines around expected.
+// It tries every allowed offset without fuzz first, then with increasing fuzz,
+// and returns the position of the untrimmed hunk together with the number of
+// leading and trailing context lines that were dropped.
+func locateHunk(lines []string, hunk *patchHunk, expected int, opts applyOptions) (pos, head, tail, fuzz int, ok bool) {
+	leading, trailing := contextEdges(hunk.lines)
+	maxOffset := opts.maxOffset
+	if maxOffset < 0 {
+		maxOffset = len(lines)
+	}
+
+	for fuzz = 0; fuzz <= opts.fuzz; fuzz++ {
+		if fuzz > 0 && head == min(fuzz, leading) && tail == min(fuzz, trailing) {
+			// No context left to drop.
+			break
+		}
+		head, tail = min(fuzz, leading), min(fuzz, trailing)
+		var want []string
+		for _, l := range trimContext(hunk.lines, head, tail) {
+			if l.op != '+' {
+				want = append(want, l.text)
+			}
+		}
+		for offset := 0; offset <= maxOffset; offset++ {
+			for _, candidate := range []int{expected + offset, expected - offset} {
+				if matchLines(lines, candidate+head, want) < 0 {
+					return candidate, head, tail, fuzz, true
+				}
+				if offset == 0 {
+					break
+				}
+			}
+		}
+	}
+	return 0, 0, 0, 0, false
+}
+
+// contextEdges counts the context lines before the first and after the last
+// change of a hunk.
+func contextEdges(lines []patchLine) (leading, trailing int) {
+	for leading < len(lines) && lines[leading].op == ' ' {
+		leading++
+	}
+	for trailing < len(lines)-leading && lines[len(lines)-1-trailing].op == ' ' {
+		trailing++
+	}
+	return leading, trailing
+}
+
+func trimContext(lines []patchLine, head, tail int) []patchLine {
+	return lines[head : len(lines)-tail]
+}
+
+// matchLines checks that want appears in lines at pos and returns the index
+// of the first line that differs, or -1 when everything matches.
+func matchLines(lines []string, pos int, want []string) int {
+	if pos < 0 {
+		return 0
+	}
+	for i, w := range want {
+		if pos+i >= len(lines) || lines[pos+i] != w {
+			return pos + i
+		}
+	}
+	return -1
+}
+
+func mismatchReason(lines []string, index int) string {
+	if index >= len(lines) {
+		return fmt.Sprintf("hunk extends past end of buffer (%d lines)", len(lines))
+	}
+	return fmt.Sprintf("context mismatch at line %d", index+1)
+}
+
+// describeResults summarizes per-hunk results for a status message.
+func describeResults(results []hunkResult) string {
+	var parts []string
+	for _, r := range results {
+		if r.applied {
+			part := fmt.Sprintf("hunk %d applied at line %d", r.index, r.line)
+			if r.offset != 0 {
+				part += fmt.Sprintf(" (offset %+d)", r.offset)
+			}
+			if r.fuzz > 0 {
+				part += fmt.Sprintf(" with fuzz %d", r.fuzz)
+			}
+			parts = append(parts, part)
+		} else {
+			parts = append(parts, fmt.Sprintf("hunk %d FAILED (%s)", r.index, r.reason))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// patchApplyOptions reads the patch-max-offset and patch-fuzz options. By
+// default hunks may move anywhere in the target and ignore up to two context
+// lines, like GNU patch.
+func (p *BufferDiffPlugin) patchApplyOptions() applyOptions {
+	return applyOptions{
+		maxOffset: p.intOption("patch-max-offset", -1),
+		fuzz:      p.intOption("patch-fuzz", 2),
+	}
+}
+
+func (p *BufferDiffPlugin) HandlePatchApply(patchBufferName, targetBufferName string) error {
+	return p.applyPatchBuffer(patchBufferName, targetBufferName, false, false)
+}
+
+func (p *BufferDiffPlugin) HandlePatchApplyPartial(patchBufferName, targetBufferName string) error {
+	return p.applyPatchBuffer(patchBufferName, targetBufferName, true, false)
+}
+
+func (p *BufferDiffPlugin) HandlePatchApplyReverse(patchBufferName, targetBufferName string) error {
+	return p.applyPatchBuffer(patchBufferName, targetBufferName, false, true)
+}
+
+// applyPatchBuffer applies the single-file patch held in patchBufferName to
+// targetBufferName, or backs it out when reverse is set. Unless partial is
+// set, nothing is changed when any hunk fails to apply.
+func (p *BufferDiffPlugin) applyPatchBuffer(patchBufferName, targetBufferName string, partial, reverse bool) error {
+	if p.host == nil {
+		return fmt.Errorf("ERROR: host is nil")
+	}
+
+	patchBuffer := p.host.FindBuffer(patchBufferName)
+	if patchBuffer == nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:Buffer not found: %s", patchBufferName)
+	}
+	target := p.host.FindBuffer(targetBufferName)
+	if target == nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:Buffer not found: %s", targetBufferName)
+	}
+
+	files, err := parsePatch(patchBuffer.Content())
+	if err != nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:Invalid patch in %s: %v", patchBufferName, err)
+	}
+	if len(files) > 1 {
+		return fmt.Errorf("PLUGIN_MESSAGE:Patch touches %d files; use patch-apply-files for multi-file patches", len(files))
+	}
+	if len(files) == 0 || len(files[0].hunks) == 0 {
+		return fmt.Errorf("PLUGIN_MESSAGE:No hunks found in %s", patchBufferName)
+	}
+
+	file := files[0]
+	if reverse {
+		file = reversePatch(file)
+	}
+
+	lines := strings.Split(target.Content(), "\n")
+	opts := p.patchApplyOptions()
+	patched, results := applyHunks(lines, file.hunks, opts)
+
+	applied := 0
+	for _, r := range results {
+		if r.applied {
+			applied++
+		}
+	}
+	summary := describeResults(results)
+
+	if applied == 0 && appliesCleanly(lines, reversePatch(file), opts) {
+		if reverse {
+			return fmt.Errorf("PLUGIN_MESSAGE:Patch does not appear to be applied to %s; use patch-apply to apply it", targetBufferName)
+		}
+		return fmt.Errorf("PLUGIN_MESSAGE:Patch appears to be already applied to %s; use patch-apply-reverse to back it out", targetBufferName)
+	}
+
+	rejectsBufferName, err := p.writeRejects(targetBufferName, file, results)
+	if err != nil {
+		return err
+	}
+
+	if applied < len(results) && !partial {
+		return fmt.Errorf("PLUGIN_MESSAGE:Patch not applied to %s: %d of %d hunks failed, see %s", targetBufferName, len(results)-applied, len(results), rejectsBufferName)
+	}
+	if applied > 0 {
+		target.SetContent(strings.Join(patched, "\n"))
+	}
+
+	message := fmt.Sprintf("Patch applied to %s: %d of %d hunks (%s)", targetBufferName, applied, len(results), summary)
+	if rejectsBufferName != "" {
+		message += fmt.Sprintf(", rejects in %s", rejectsBufferName)
+	}
+	return fmt.Errorf("PLUGIN_MESSAGE:%s", message)
+}
+
+// reversePatch returns a copy of file that undoes it: old and new sides are
+// swapped and removed lines become added lines and vice versa.
+func reversePatch(file *filePatch) *filePatch {
+	reversed := &filePatch{oldName: file.newName, newName: file.oldName}
+	for _, h := range file.hunks {
+		r := &patchHunk{
+			oldStart:   h.newStart,
+			oldCount:   h.newCount,
+			newStart:   h.oldStart,
+			newCount:   h.oldCount,
+			section:    h.section,
+			headerLine: h.headerLine,
+			lines:      make([]patchLine, len(h.lines)),
+		}
+		for i, l := range h.lines {
+			switch l.op {
+			case '-':
+				l.op = '+'
+			case '+':
+				l.op = '-'
+			}
+			r.lines[i] = l
+		}
+		reversed.hunks = append(reversed.hunks, r)
+	}
+	return reversed
+}
+
+// appliesCleanly reports whether every hunk of file applies to lines.
+func appliesCleanly(lines []string, file *filePatch, opts applyOptions) bool {
+	_, results := applyHunks(lines, file.hunks, opts)
+	for _, r := range results {
+		if !r.applied {
+			return false
+		}
+	}
+	return len(results) > 0
+}
+
+// formatRejects renders the hunks that failed to apply as a unified diff.
+// Each hunk is preceded by a comment with the reason; parsePatch skips these
+// lines, so the buffer can be fixed up and applied again.
+func formatRejects(file *filePatch, results []hunkResult) []string {
+	var lines []string
+	for _, r := range results {
+		if r.applied {
+			continue
+		}
+		if lines == nil {
+			lines = append(lines, fmt.Sprintf("--- %s", file.oldName), fmt.Sprintf("+++ %s", file.newName))
+		}
+		hunk := file.hunks[r.index-1]
+		lines = append(lines, fmt.Sprintf("# Hunk %d FAILED: %s", r.index, r.reason), hunk.header())
+		for _, l := range hunk.lines {
+			lines = append(lines, string(l.op)+l.text)
+		}
+	}
+	return lines
+}
+
+// writeRejects stores the failed hunks in the *Rejects: target* buffer and
+// returns its name, or "" when every hunk applied. A stale rejects buffer
+// from an earlier run is emptied.
+func (p *BufferDiffPlugin) writeRejects(targetBufferName string, file *filePatch, results []hunkResult) (string, error) {
+	rejectsBufferName := fmt.Sprintf("*Rejects: %s*", targetBufferName)
+	rejects := formatRejects(file, results)
+
+	rejectsBuffer := p.host.FindBuffer(rejectsBufferName)
+	if len(rejects) == 0 {
+		if rejectsBuffer != nil {
+			rejectsBuffer.SetContent("")
+		}
+		return "", nil
+	}
+
+	if rejectsBuffer == nil {
+		rejectsBuffer = p.host.CreateBuffer(rejectsBufferName)
+		if rejectsBuffer == nil {
+			return "", fmt.Errorf("PLUGIN_MESSAGE:Failed to create rejects buffer")
+		}
+	}
+	rejectsBuffer.SetContent(strings.Join(rejects, "\n"))
+	p.setDiffMode(rejectsBufferName, rejectsBuffer.Content())
+	return rejectsBufferName, nil
+}
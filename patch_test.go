@@ -0,0 +1,227 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const samplePatch = `--- a.txt
++++ a.txt
+@@ -1,3 +1,3 @@
+ one
+-two
++TWO
+ three
+@@ -6,2 +6,3 @@ section
+ six
++six and a half
+ seven
+`
+
+func TestParsePatchUnified(t *testing.T) {
+	files, err := parsePatch(samplePatch)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 file, got %d", len(files))
+	}
+	if files[0].oldName != "a.txt" || files[0].newName != "a.txt" {
+		t.Errorf("Unexpected file names: '%s', '%s'", files[0].oldName, files[0].newName)
+	}
+	if len(files[0].hunks) != 2 {
+		t.Fatalf("Expected 2 hunks, got %d", len(files[0].hunks))
+	}
+
+	second := files[0].hunks[1]
+	if second.oldStart != 6 || second.oldCount != 2 || second.newStart != 6 || second.newCount != 3 {
+		t.Errorf("Unexpected ranges: %s", second.header())
+	}
+	if second.section != "section" {
+		t.Errorf("Expected section 'section', got '%s'", second.section)
+	}
+	if second.headerLine != 7 {
+		t.Errorf("Expected header on line 7, got %d", second.headerLine)
+	}
+}
+
+func TestParsePatchTruncatedHunk(t *testing.T) {
+	_, err := parsePatch("--- a\n+++ b\n@@ -1,3 +1,3 @@\n one\n-two\n")
+	if err == nil {
+		t.Error("Expected error for truncated hunk")
+	}
+}
+
+func TestParsePatchListing(t *testing.T) {
+	plugin := &BufferDiffPlugin{}
+	diff := plugin.createSimpleDiff("a", "1\n2\n3\n4\n5\n6\n7\n8\n9\n10", "b", "1\n2\n3\n4\n5\n6\n7\n8\n9\nten")
+
+	files, err := parsePatch(strings.Join(diff, "\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(files) != 1 || len(files[0].hunks) != 1 {
+		t.Fatalf("Expected a single hunk, got %+v", files)
+	}
+
+	hunk := files[0].hunks[0]
+	if hunk.header() != "@@ -7,4 +7,4 @@" {
+		t.Errorf("Expected '@@ -7,4 +7,4 @@', got '%s'", hunk.header())
+	}
+	if hunk.lines[0].bufLine != 9 {
+		t.Errorf("Expected first hunk line to map to buffer line 9, got %d", hunk.lines[0].bufLine)
+	}
+}
+
+func TestApplyHunks(t *testing.T) {
+	files, err := parsePatch(samplePatch)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	lines := strings.Split("one\ntwo\nthree\nfour\nfive\nsix\nseven\n", "\n")
+	patched, results := applyHunks(lines, files[0].hunks, exactApply)
+
+	expected := "one\nTWO\nthree\nfour\nfive\nsix\nsix and a half\nseven\n"
+	if got := strings.Join(patched, "\n"); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+	for _, r := range results {
+		if !r.applied {
+			t.Errorf("Expected hunk %d to apply: %s", r.index, r.reason)
+		}
+	}
+}
+
+func TestApplyHunksMismatch(t *testing.T) {
+	files, err := parsePatch(samplePatch)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	lines := strings.Split("one\nzwei\nthree\nfour\nfive\nsix\nseven\n", "\n")
+	_, results := applyHunks(lines, files[0].hunks, exactApply)
+
+	if results[0].applied {
+		t.Error("Expected hunk 1 to fail")
+	}
+	if results[0].reason != "context mismatch at line 2" {
+		t.Errorf("Unexpected reason: %s", results[0].reason)
+	}
+	if !results[1].applied || results[1].line != 6 {
+		t.Errorf("Expected hunk 2 to apply at line 6, got %+v", results[1])
+	}
+}
+
+func TestHandlePatchApplyRefusesOnMismatch(t *testing.T) {
+	patch := &mockBuffer{name: "patch", content: samplePatch}
+	target := &mockBuffer{name: "target", content: "one\nzwei\nthree\nfour\nfive\nsix\nseven\n"}
+	plugin := &BufferDiffPlugin{host: newMockHost(patch, target)}
+
+	err := plugin.ExecuteCommand("patch-apply", "patch", "target")
+	if err == nil || !strings.HasPrefix(err.Error(), "PLUGIN_MESSAGE:Patch not applied") {
+		t.Errorf("Expected refusal, got %v", err)
+	}
+	if target.dirty {
+		t.Error("Expected target to be left untouched")
+	}
+
+	err = plugin.ExecuteCommand("patch-apply-partial", "patch", "target")
+	if err == nil || !strings.HasPrefix(err.Error(), "PLUGIN_MESSAGE:Patch applied to target: 1 of 2 hunks") {
+		t.Errorf("Expected partial application, got %v", err)
+	}
+	if !strings.Contains(target.content, "six and a half") {
+		t.Errorf("Expected hunk 2 to be applied, got %q", target.content)
+	}
+}
+
+func TestApplyHunksOffsetAndFuzz(t *testing.T) {
+	files, err := parsePatch(samplePatch)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Two extra lines at the top move both hunks down, and the context
+	// around the second hunk no longer matches on its trailing side.
+	lines := strings.Split("x\ny\none\ntwo\nthree\nfour\nfive\nsix\nSEVEN\n", "\n")
+
+	_, results := applyHunks(lines, files[0].hunks, exactApply)
+	if results[0].applied {
+		t.Error("Expected exact application to fail")
+	}
+
+	patched, results := applyHunks(lines, files[0].hunks, applyOptions{maxOffset: -1, fuzz: 1})
+	if !results[0].applied || results[0].offset != 2 || results[0].fuzz != 0 {
+		t.Errorf("Expected hunk 1 at offset +2 without fuzz, got %+v", results[0])
+	}
+	if !results[1].applied || results[1].offset != 0 || results[1].fuzz != 1 {
+		t.Errorf("Expected hunk 2 with fuzz 1 relative to hunk 1, got %+v", results[1])
+	}
+	expected := "x\ny\none\nTWO\nthree\nfour\nfive\nsix\nsix and a half\nSEVEN\n"
+	if got := strings.Join(patched, "\n"); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+	if summary := describeResults(results); !strings.Contains(summary, "hunk 1 applied at line 3 (offset +2)") {
+		t.Errorf("Unexpected summary: %s", summary)
+	}
+
+	_, results = applyHunks(lines, files[0].hunks, applyOptions{maxOffset: 1, fuzz: 2})
+	if results[0].applied {
+		t.Error("Expected hunk 1 to fail beyond the maximum offset")
+	}
+}
+
+func TestHandlePatchApplyWritesRejects(t *testing.T) {
+	patch := &mockBuffer{name: "patch", content: samplePatch}
+	target := &mockBuffer{name: "target", content: "one\nzwei\nthree\nfour\nfive\nsix\nseven\n"}
+	host := newMockHost(patch, target)
+	plugin := &BufferDiffPlugin{host: host}
+
+	err := plugin.ExecuteCommand("patch-apply-partial", "patch", "target")
+	if err == nil || !strings.HasSuffix(err.Error(), "rejects in *Rejects: target*") {
+		t.Errorf("Expected rejects to be reported, got %v", err)
+	}
+
+	rejects := host.FindBuffer("*Rejects: target*")
+	if rejects == nil {
+		t.Fatal("Expected rejects buffer to be created")
+	}
+	expected := "--- a.txt\n+++ a.txt\n# Hunk 1 FAILED: context mismatch at line 2\n@@ -1,3 +1,3 @@\n one\n-two\n+TWO\n three"
+	if rejects.Content() != expected {
+		t.Errorf("Expected rejects %q, got %q", expected, rejects.Content())
+	}
+
+	// The rejects buffer is itself a valid patch once the context is fixed.
+	host.buffers["*Rejects: target*"].content = strings.Replace(expected, "-two", "-zwei", 1)
+	err = plugin.ExecuteCommand("patch-apply", "*Rejects: target*", "target")
+	if err == nil || !strings.HasPrefix(err.Error(), "PLUGIN_MESSAGE:Patch applied to target: 1 of 1 hunks") {
+		t.Errorf("Expected reapplied rejects, got %v", err)
+	}
+	if !strings.HasPrefix(target.content, "one\nTWO\nthree") {
+		t.Errorf("Expected fixed hunk to be applied, got %q", target.content)
+	}
+}
+
+func TestHandlePatchApplyReverse(t *testing.T) {
+	a := &mockBuffer{name: "a", content: "one\n\nthree\nfour"}
+	b := &mockBuffer{name: "b", content: "one\ntwo\nthree\nfour\nfive"}
+	host := newMockHost(a, b)
+	plugin := &BufferDiffPlugin{host: host}
+
+	plugin.ExecuteCommand("buffer-diff", "a", "b")
+	diffName := "*Diff: a <-> b*"
+
+	// b already contains the changes, so applying forward is refused.
+	err := plugin.ExecuteCommand("patch-apply", diffName, "b")
+	if err == nil || !strings.Contains(err.Error(), "already applied to b; use patch-apply-reverse") {
+		t.Errorf("Expected already-applied detection, got %v", err)
+	}
+
+	err = plugin.ExecuteCommand("patch-apply-reverse", diffName, "b")
+	if err == nil || !strings.HasPrefix(err.Error(), "PLUGIN_MESSAGE:Patch applied to b") {
+		t.Errorf("Expected reverse application, got %v", err)
+	}
+	if b.content != a.content {
+		t.Errorf("Expected b to be backed out to %q, got %q", a.content, b.content)
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	pluginsdk "github.com/TakahashiShuuhei/gmacs-plugin-sdk"
+)
+
+// patchReportBufferName is where patch-apply-files writes its per-file report.
+const patchReportBufferName = "*Patch Report*"
+
+// fileApplication tracks one file of a multi-file patch between computing
+// the patched content and writing it out.
+type fileApplication struct {
+	file    *filePatch
+	path    string
+	buffer  pluginsdk.BufferInterface // nil for created files
+	patched []string
+	results []hunkResult
+	err     error // problem with the file itself, as opposed to its hunks
+	status  string
+}
+
+func (a *fileApplication) applied() int {
+	count := 0
+	for _, r := range a.results {
+		if r.applied {
+			count++
+		}
+	}
+	return count
+}
+
+func (a *fileApplication) ok() bool {
+	return a.err == nil && a.applied() == len(a.results)
+}
+
+// targetName returns the path a file patch applies to. The a/ and b/
+// prefixes written by git are stripped, like patch -p1.
+func (f *filePatch) targetName() string {
+	name := f.newName
+	if f.deleted || name == devNull {
+		name = f.oldName
+	}
+	if f.gitStyle() {
+		name = name[2:]
+	}
+	return name
+}
+
+// checkTargetName rejects target names that would reach outside the
+// directory the patch is applied in, as GNU patch does.
+func checkTargetName(name string) error {
+	if name == "" {
+		return fmt.Errorf("empty file name")
+	}
+	if filepath.IsAbs(name) || strings.HasPrefix(name, "/") {
+		return fmt.Errorf("refusing absolute file name")
+	}
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == filepath.Separator }) {
+		if part == ".." {
+			return fmt.Errorf("refusing file name with '..' component")
+		}
+	}
+	return nil
+}
+
+// gitStyle reports whether the names carry git's a/ and b/ prefixes.
+func (f *filePatch) gitStyle() bool {
+	return (strings.HasPrefix(f.oldName, "a/") || f.oldName == devNull) &&
+		(strings.HasPrefix(f.newName, "b/") || f.newName == devNull)
+}
+
+func (p *BufferDiffPlugin) HandlePatchApplyFiles(patchBufferName, baseDir string) error {
+	return p.applyPatchFiles(patchBufferName, baseDir, false)
+}
+
+func (p *BufferDiffPlugin) HandlePatchApplyFilesPartial(patchBufferName, baseDir string) error {
+	return p.applyPatchFiles(patchBufferName, baseDir, true)
+}
+
+// applyPatchFiles applies a multi-file patch to files on disk relative to
+// baseDir. Files are only saved when every hunk of every file applies, unless
+// partial is set, in which case each file gets the hunks that match.
+func (p *BufferDiffPlugin) applyPatchFiles(patchBufferName, baseDir string, partial bool) error {
+	if p.host == nil {
+		return fmt.Errorf("ERROR: host is nil")
+	}
+
+	patchBuffer := p.host.FindBuffer(patchBufferName)
+	if patchBuffer == nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:Buffer not found: %s", patchBufferName)
+	}
+	files, err := parsePatch(patchBuffer.Content())
+	if err != nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:Invalid patch in %s: %v", patchBufferName, err)
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("PLUGIN_MESSAGE:No files found in %s", patchBufferName)
+	}
+	if baseDir == "" {
+		baseDir = "."
+	}
+
+	opts := p.patchApplyOptions()
+	apps := make([]*fileApplication, 0, len(files))
+	allOK := true
+	for _, file := range files {
+		app := p.prepareFileApplication(file, baseDir, opts)
+		apps = append(apps, app)
+		allOK = allOK && app.ok()
+	}
+
+	for _, app := range apps {
+		if allOK || partial {
+			p.commitFileApplication(app, partial)
+		} else {
+			app.status = "not saved"
+		}
+		if app.err == nil {
+			if _, err := p.writeRejects(app.path, app.file, app.results); err != nil {
+				return err
+			}
+		}
+	}
+
+	report := formatPatchReport(patchBufferName, baseDir, apps)
+	reportBuffer := p.host.FindBuffer(patchReportBufferName)
+	if reportBuffer == nil {
+		reportBuffer = p.host.CreateBuffer(patchReportBufferName)
+		if reportBuffer == nil {
+			return fmt.Errorf("PLUGIN_MESSAGE:Failed to create patch report buffer")
+		}
+	}
+	reportBuffer.SetContent(strings.Join(report, "\n"))
+	if err := p.host.SwitchToBuffer(patchReportBufferName); err != nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:Failed to switch to patch report buffer: %v", err)
+	}
+
+	failed := 0
+	for _, app := range apps {
+		if !app.ok() {
+			failed++
+		}
+	}
+	if failed > 0 && !partial {
+		return fmt.Errorf("PLUGIN_MESSAGE:Patch not applied: %d of %d files failed, nothing saved", failed, len(apps))
+	}
+	return fmt.Errorf("PLUGIN_MESSAGE:Patch applied to %d of %d files", len(apps)-failed, len(apps))
+}
+
+// prepareFileApplication reads the current content of a patch target and
+// applies the hunks in memory. Targets outside baseDir and buffers with
+// unsaved edits are refused, since saving would write those edits too and
+// removing the file would lose them.
+func (p *BufferDiffPlugin) prepareFileApplication(file *filePatch, baseDir string, opts applyOptions) *fileApplication {
+	name := file.targetName()
+	if err := checkTargetName(name); err != nil {
+		return &fileApplication{file: file, path: name, err: err}
+	}
+	app := &fileApplication{file: file, path: filepath.Join(baseDir, name)}
+
+	var lines []string
+	switch {
+	case file.created:
+		if _, err := os.Stat(app.path); err == nil {
+			app.err = fmt.Errorf("file already exists")
+			return app
+		}
+		lines = []string{""}
+	default:
+		if file.deleted {
+			if _, err := os.Stat(app.path); err != nil {
+				app.err = err
+				return app
+			}
+		}
+		buffer, err := p.openFileBuffer(app.path)
+		if err != nil {
+			app.err = err
+			return app
+		}
+		if buffer.IsDirty() {
+			app.err = fmt.Errorf("buffer %s has unsaved changes", buffer.Name())
+			return app
+		}
+		app.buffer = buffer
+		lines = strings.Split(buffer.Content(), "\n")
+	}
+
+	app.patched, app.results = applyHunks(lines, file.hunks, opts)
+	if file.deleted && app.ok() && strings.Join(app.patched, "\n") != "" {
+		app.err = fmt.Errorf("file is not empty after removing the patched lines")
+	}
+	return app
+}
+
+// commitFileApplication saves a patched file, creates it, or removes it.
+// With partial set, files whose hunks only partly applied are saved too;
+// deletions always require every hunk to match.
+func (p *BufferDiffPlugin) commitFileApplication(app *fileApplication, partial bool) {
+	if app.err != nil {
+		return
+	}
+	if !app.ok() && (!partial || app.applied() == 0 || app.file.deleted) {
+		app.status = "not saved"
+		return
+	}
+
+	if app.file.deleted {
+		if err := os.Remove(app.path); err != nil {
+			app.err = err
+			return
+		}
+		app.status = fmt.Sprintf("deleted, buffer %s still visits it", app.buffer.Name())
+		return
+	}
+
+	buffer := app.buffer
+	if buffer == nil {
+		var err error
+		if buffer, err = p.openFileBuffer(app.path); err != nil {
+			app.err = err
+			return
+		}
+	}
+	buffer.SetContent(strings.Join(app.patched, "\n"))
+	if err := p.host.SaveBuffer(buffer.Name()); err != nil {
+		app.err = fmt.Errorf("save failed: %v", err)
+		return
+	}
+	if app.file.created {
+		app.status = "created"
+	} else {
+		app.status = "saved"
+	}
+}
+
+// openFileBuffer visits path in the host and returns the buffer holding it.
+func (p *BufferDiffPlugin) openFileBuffer(path string) (pluginsdk.BufferInterface, error) {
+	if err := p.host.OpenFile(path); err != nil {
+		return nil, fmt.Errorf("open failed: %v", err)
+	}
+	buffer := p.host.GetCurrentBuffer()
+	if buffer == nil {
+		return nil, fmt.Errorf("no buffer after opening %s", path)
+	}
+	return buffer, nil
+}
+
+func formatPatchReport(patchBufferName, baseDir string, apps []*fileApplication) []string {
+	report := []string{
+		fmt.Sprintf("Patch: %s", patchBufferName),
+		fmt.Sprintf("Directory: %s", baseDir),
+		"",
+	}
+	for _, app := range apps {
+		switch {
+		case app.err != nil:
+			report = append(report, fmt.Sprintf("%s: FAILED (%v)", app.path, app.err))
+		case app.ok():
+			report = append(report, fmt.Sprintf("%s: %d hunks applied, %s", app.path, len(app.results), app.status))
+		default:
+			report = append(report, fmt.Sprintf("%s: %d of %d hunks FAILED, %s, rejects in *Rejects: %s*",
+				app.path, len(app.results)-app.applied(), len(app.results), app.status, app.path))
+		}
+		if len(app.results) > 0 {
+			report = append(report, "  "+describeResults(app.results))
+		}
+	}
+	return report
+}
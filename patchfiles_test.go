@@ -0,0 +1,220 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const multiFilePatch = `diff --git a/keep.txt b/keep.txt
+index 1111111..2222222 100644
+--- a/keep.txt
++++ b/keep.txt
+@@ -1,2 +1,2 @@
+ alpha
+-beta
++BETA
+diff --git a/new.txt b/new.txt
+new file mode 100644
+index 0000000..3333333
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1,2 @@
++fresh
++file
+diff --git a/old.txt b/old.txt
+deleted file mode 100644
+index 4444444..0000000
+--- a/old.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-gone
+`
+
+func TestParsePatchGitEntries(t *testing.T) {
+	files, err := parsePatch(multiFilePatch)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("Expected 3 files, got %d", len(files))
+	}
+
+	expected := []struct {
+		target           string
+		created, deleted bool
+	}{
+		{"keep.txt", false, false},
+		{"new.txt", true, false},
+		{"old.txt", false, true},
+	}
+	for i, e := range expected {
+		f := files[i]
+		if f.targetName() != e.target || f.created != e.created || f.deleted != e.deleted {
+			t.Errorf("File %d: expected %+v, got target=%s created=%v deleted=%v", i, e, f.targetName(), f.created, f.deleted)
+		}
+		if len(f.hunks) != 1 {
+			t.Errorf("File %d: expected 1 hunk, got %d", i, len(f.hunks))
+		}
+	}
+}
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestHandlePatchApplyFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"keep.txt": "alpha\nbeta\n", "old.txt": "gone\n"})
+
+	host := newMockHost(&mockBuffer{name: "patch", content: multiFilePatch})
+	plugin := &BufferDiffPlugin{host: host}
+
+	err := plugin.ExecuteCommand("patch-apply-files", "patch", dir)
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:Patch applied to 3 of 3 files" {
+		t.Errorf("Expected all files to be patched, got %v", err)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, "keep.txt"))
+	if string(data) != "alpha\nBETA\n" {
+		t.Errorf("Unexpected keep.txt content: %q", data)
+	}
+	data, _ = os.ReadFile(filepath.Join(dir, "new.txt"))
+	if string(data) != "fresh\nfile\n" {
+		t.Errorf("Unexpected new.txt content: %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.txt")); !os.IsNotExist(err) {
+		t.Error("Expected old.txt to be deleted")
+	}
+
+	report := host.FindBuffer(patchReportBufferName)
+	if report == nil || !strings.Contains(report.Content(), "new.txt: 1 hunks applied, created") {
+		t.Errorf("Unexpected report: %v", report)
+	}
+	oldPath := filepath.Join(dir, "old.txt")
+	if !strings.Contains(report.Content(), "old.txt: 1 hunks applied, deleted, buffer "+oldPath+" still visits it") {
+		t.Errorf("Expected the report to name the buffer of old.txt, got %q", report.Content())
+	}
+}
+
+func TestHandlePatchApplyFilesRefusesDirtyDeletedFile(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"old.txt": "gone\n"})
+	path := filepath.Join(dir, "old.txt")
+
+	patch := "--- a/old.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-gone\n"
+	host := newMockHost(&mockBuffer{name: "patch", content: patch})
+	host.buffers["old.txt"] = &mockBuffer{name: "old.txt", content: "gone\nunsaved\n", filename: path, dirty: true}
+	plugin := &BufferDiffPlugin{host: host}
+
+	err := plugin.ExecuteCommand("patch-apply-files", "patch", dir)
+	if err == nil || !strings.HasPrefix(err.Error(), "PLUGIN_MESSAGE:Patch not applied: 1 of 1 files failed") {
+		t.Errorf("Expected the dirty buffer to be refused, got %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Error("Expected old.txt to be kept")
+	}
+	report := host.FindBuffer(patchReportBufferName).Content()
+	if !strings.Contains(report, "FAILED (buffer old.txt has unsaved changes)") {
+		t.Errorf("Unexpected report: %q", report)
+	}
+}
+
+func TestHandlePatchApplyFilesSavesNothingOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"keep.txt": "alpha\nbeta\n", "old.txt": "still here\n"})
+
+	host := newMockHost(&mockBuffer{name: "patch", content: multiFilePatch})
+	plugin := &BufferDiffPlugin{host: host}
+
+	err := plugin.ExecuteCommand("patch-apply-files", "patch", dir)
+	if err == nil || !strings.HasPrefix(err.Error(), "PLUGIN_MESSAGE:Patch not applied: 1 of 3 files failed") {
+		t.Errorf("Expected failure, got %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "keep.txt"))
+	if string(data) != "alpha\nbeta\n" {
+		t.Errorf("Expected keep.txt to be untouched, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new.txt")); !os.IsNotExist(err) {
+		t.Error("Expected new.txt not to be created")
+	}
+
+	err = plugin.ExecuteCommand("patch-apply-files-partial", "patch", dir)
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:Patch applied to 2 of 3 files" {
+		t.Errorf("Expected partial application, got %v", err)
+	}
+	data, _ = os.ReadFile(filepath.Join(dir, "keep.txt"))
+	if string(data) != "alpha\nBETA\n" {
+		t.Errorf("Unexpected keep.txt content: %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.txt")); err != nil {
+		t.Error("Expected old.txt to be kept")
+	}
+}
+
+func TestHandlePatchApplyFilesRefusesPathsOutsideDir(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "work")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFiles(t, root, map[string]string{"outside.txt": "alpha\n"})
+
+	patch := "--- a/../outside.txt\n+++ b/../outside.txt\n@@ -1 +1 @@\n-alpha\n+ALPHA\n" +
+		"--- /dev/null\n+++ " + filepath.Join(root, "abs.txt") + "\n@@ -0,0 +1 @@\n+new\n"
+	host := newMockHost(&mockBuffer{name: "patch", content: patch})
+	plugin := &BufferDiffPlugin{host: host}
+
+	err := plugin.ExecuteCommand("patch-apply-files-partial", "patch", dir)
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:Patch applied to 0 of 2 files" {
+		t.Errorf("Expected both files to be refused, got %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(root, "outside.txt"))
+	if string(data) != "alpha\n" {
+		t.Errorf("Expected outside.txt to be untouched, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(root, "abs.txt")); !os.IsNotExist(err) {
+		t.Error("Expected abs.txt not to be created")
+	}
+
+	report := host.FindBuffer(patchReportBufferName).Content()
+	if !strings.Contains(report, "../outside.txt: FAILED (refusing file name with '..' component)") {
+		t.Errorf("Expected the '..' target in the report, got %q", report)
+	}
+	if !strings.Contains(report, "abs.txt: FAILED (refusing absolute file name)") {
+		t.Errorf("Expected the absolute target in the report, got %q", report)
+	}
+}
+
+func TestHandlePatchApplyFilesRefusesDirtyBuffers(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"keep.txt": "alpha\nbeta\n"})
+	path := filepath.Join(dir, "keep.txt")
+
+	patch := "--- a/keep.txt\n+++ b/keep.txt\n@@ -1,2 +1,2 @@\n alpha\n-beta\n+BETA\n"
+	host := newMockHost(&mockBuffer{name: "patch", content: patch})
+	host.buffers["keep.txt"] = &mockBuffer{name: "keep.txt", content: "alpha\nbeta\nunsaved\n", filename: path, dirty: true}
+	plugin := &BufferDiffPlugin{host: host}
+
+	err := plugin.ExecuteCommand("patch-apply-files", "patch", dir)
+	if err == nil || !strings.HasPrefix(err.Error(), "PLUGIN_MESSAGE:Patch not applied: 1 of 1 files failed") {
+		t.Errorf("Expected the dirty buffer to be refused, got %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "alpha\nbeta\n" {
+		t.Errorf("Expected keep.txt to be untouched, got %q", data)
+	}
+	if !host.buffers["keep.txt"].dirty || !strings.Contains(host.buffers["keep.txt"].content, "unsaved") {
+		t.Error("Expected the unsaved edits to stay in the buffer")
+	}
+	report := host.FindBuffer(patchReportBufferName).Content()
+	if !strings.Contains(report, "FAILED (buffer keep.txt has unsaved changes)") {
+		t.Errorf("Unexpected report: %q", report)
+	}
+}
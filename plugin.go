@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/rpc"
 	"strings"
+	"sync"
 
 	"github.com/hashicorp/go-plugin"
 	pluginsdk "github.com/TakahashiShuuhei/gmacs-plugin-sdk"
@@ -12,6 +13,63 @@ import (
 
 type BufferDiffPlugin struct {
 	host pluginsdk.HostInterface
+
+	// minorModes records the minor modes this plugin enabled, keyed by
+	// buffer and mode name (see minorModeKey).
+	minorModes map[string]bool
+
+	// sessions holds the comparison session of each diff buffer, keyed by
+	// the diff buffer's name.
+	sessions map[string]*diffSession
+
+	// mu guards the state hook handlers share with commands.
+	mu sync.Mutex
+	// gutters records the buffers with diff-gutter-mode on; gutterHooked is
+	// set once the gutter hooks are registered with the host.
+	gutters      map[string]bool
+	gutterHooked bool
+	// watches holds the diff buffers in diff-watch-mode; watchHooked is set
+	// once the watch hooks are registered with the host.
+	watches     map[string]*diffWatch
+	watchHooked bool
+
+	// optionBuffers records the buffers with options published through
+	// setBufferOption, under mu; killHooked is set once the hook forgetting
+	// killed buffers is registered with the host.
+	optionBuffers map[string]bool
+	killHooked    bool
+
+	// recentBuffers lists the buffers compared most recently first, to
+	// order buffer name completions. It is replaced, never modified, under
+	// mu.
+	recentBuffers []string
+
+	// history holds the comparisons made, most recent first; it is read
+	// from the history file on first use.
+	history       []historyEntry
+	historyLoaded bool
+	// historyListing is the history as last shown in *Diff History*.
+	historyListing []historyEntry
+
+	// scrollSyncs holds the diff buffers in diff-sync-scroll-mode, under mu;
+	// scrollHooked is set once the scroll hook is registered with the host.
+	scrollSyncs  map[string]*scrollSync
+	scrollHooked bool
+
+	// snapshots maps the buffers holding a file as it is on disk, made by
+	// buffer-diff-with-file, to the file's path.
+	snapshots map[string]string
+
+	// compareWith records the buffer each buffer was last compared with by
+	// compare-windows.
+	compareWith map[string]string
+
+	// folds holds the folding done by hand in each diff buffer.
+	folds map[string]*foldState
+
+	// execMu serializes commands with the refreshes diff-watch-mode runs in
+	// the background.
+	execMu sync.Mutex
 }
 
 func (p *BufferDiffPlugin) Name() string {
@@ -29,11 +87,13 @@ func (p *BufferDiffPlugin) Description() string {
 func (p *BufferDiffPlugin) Initialize(ctx context.Context, host pluginsdk.HostInterface) error {
 	fmt.Printf("[PLUGIN] Initialize called with host: %T\n", host)
 	p.host = host
+	p.publishDiffSyntax()
 	fmt.Printf("[PLUGIN] Initialize completed, host stored: %v\n", p.host != nil)
 	return nil
 }
 
 func (p *BufferDiffPlugin) Cleanup() error {
+	p.stopWatching()
 	return nil
 }
 
@@ -54,6 +114,272 @@ func (p *BufferDiffPlugin) GetCommands() []pluginsdk.CommandSpec {
 			Handler:     "HandleBufferDiffCurrent",
 			ArgPrompts:  []string{"Compare current buffer with: "},
 		},
+		{
+			Name:        "patch-apply",
+			Description: "Apply a unified diff buffer to another buffer",
+			Interactive: true,
+			Handler:     "HandlePatchApply",
+			ArgPrompts:  []string{"Patch buffer: ", "Apply to buffer: "},
+		},
+		{
+			Name:        "patch-apply-partial",
+			Description: "Apply the hunks of a unified diff buffer that match",
+			Interactive: true,
+			Handler:     "HandlePatchApplyPartial",
+			ArgPrompts:  []string{"Patch buffer: ", "Apply to buffer: "},
+		},
+		{
+			Name:        "patch-apply-reverse",
+			Description: "Back out a unified diff buffer from another buffer",
+			Interactive: true,
+			Handler:     "HandlePatchApplyReverse",
+			ArgPrompts:  []string{"Patch buffer: ", "Reverse-apply to buffer: "},
+		},
+		{
+			Name:        "patch-apply-files",
+			Description: "Apply a multi-file patch buffer to files on disk",
+			Interactive: true,
+			Handler:     "HandlePatchApplyFiles",
+			ArgPrompts:  []string{"Patch buffer: ", "Base directory: "},
+		},
+		{
+			Name:        "patch-apply-files-partial",
+			Description: "Apply the matching hunks of a multi-file patch buffer to files on disk",
+			Interactive: true,
+			Handler:     "HandlePatchApplyFilesPartial",
+			ArgPrompts:  []string{"Patch buffer: ", "Base directory: "},
+		},
+		{
+			Name:        "diff-hunk-copy-to-a",
+			Description: "Copy the second buffer's version of the hunk at point into the first buffer",
+			Interactive: true,
+			Handler:     "HandleDiffHunkCopyToA",
+		},
+		{
+			Name:        "diff-hunk-copy-to-b",
+			Description: "Copy the first buffer's version of the hunk at point into the second buffer",
+			Interactive: true,
+			Handler:     "HandleDiffHunkCopyToB",
+		},
+		{
+			Name:        "diff-hunk-revert",
+			Description: "Revert the hunk at point in the second buffer",
+			Interactive: true,
+			Handler:     "HandleDiffHunkCopyToB",
+		},
+		{
+			Name:        "diff-split-hunk",
+			Description: "Split the hunk at point into two hunks at the current context line",
+			Interactive: true,
+			Handler:     "HandleDiffSplitHunk",
+		},
+		{
+			Name:        "diff-recount-hunks",
+			Description: "Recompute the @@ line counts of every hunk after manual edits",
+			Interactive: true,
+			Handler:     "HandleDiffRecountHunks",
+		},
+		{
+			Name:        "buffer-merge3",
+			Description: "Three-way merge of two buffers against a common base",
+			Interactive: true,
+			Handler:     "HandleBufferMerge3",
+			ArgPrompts:  []string{"Mine buffer: ", "Base buffer: ", "Theirs buffer: "},
+		},
+		{
+			Name:        "merge-conflict-mode",
+			Description: "Toggle the conflict navigation and resolution keys in the current buffer",
+			Interactive: true,
+			Handler:     "HandleMergeConflictMode",
+		},
+		{
+			Name:        "merge-next-conflict",
+			Description: "Move to the next merge conflict",
+			Interactive: true,
+			Handler:     "HandleMergeNextConflict",
+		},
+		{
+			Name:        "merge-prev-conflict",
+			Description: "Move to the previous merge conflict",
+			Interactive: true,
+			Handler:     "HandleMergePrevConflict",
+		},
+		{
+			Name:        "merge-keep-mine",
+			Description: "Resolve the conflict at point by keeping mine",
+			Interactive: true,
+			Handler:     "HandleMergeKeepMine",
+		},
+		{
+			Name:        "merge-keep-theirs",
+			Description: "Resolve the conflict at point by keeping theirs",
+			Interactive: true,
+			Handler:     "HandleMergeKeepTheirs",
+		},
+		{
+			Name:        "merge-keep-base",
+			Description: "Resolve the conflict at point by keeping the base version",
+			Interactive: true,
+			Handler:     "HandleMergeKeepBase",
+		},
+		{
+			Name:        "merge-keep-both",
+			Description: "Resolve the conflict at point by keeping mine followed by theirs",
+			Interactive: true,
+			Handler:     "HandleMergeKeepBoth",
+		},
+		{
+			Name:        "merge-refine",
+			Description: "Show the differences between the two sides of the conflict at point",
+			Interactive: true,
+			Handler:     "HandleMergeRefine",
+		},
+		{
+			Name:        "merge-resolve-trivial",
+			Description: "Resolve every conflict where only one side changed or both made the same change",
+			Interactive: true,
+			Handler:     "HandleMergeResolveTrivial",
+		},
+		{
+			Name:        "diff-session-next",
+			Description: "Move to the next difference in both compared buffers",
+			Interactive: true,
+			Handler:     "HandleDiffSessionNext",
+		},
+		{
+			Name:        "diff-session-prev",
+			Description: "Move to the previous difference in both compared buffers",
+			Interactive: true,
+			Handler:     "HandleDiffSessionPrev",
+		},
+		{
+			Name:        "diff-session-copy-a-to-b",
+			Description: "Copy the current difference from buffer A to buffer B",
+			Interactive: true,
+			Handler:     "HandleDiffSessionCopyAToB",
+		},
+		{
+			Name:        "diff-session-copy-b-to-a",
+			Description: "Copy the current difference from buffer B to buffer A",
+			Interactive: true,
+			Handler:     "HandleDiffSessionCopyBToA",
+		},
+		{
+			Name:        "diff-hunk-next",
+			Description: "Move to the next hunk in a diff buffer",
+			Interactive: true,
+			Handler:     "HandleDiffHunkNext",
+		},
+		{
+			Name:        "diff-hunk-prev",
+			Description: "Move to the previous hunk in a diff buffer",
+			Interactive: true,
+			Handler:     "HandleDiffHunkPrev",
+		},
+		{
+			Name:        "diff-file-next",
+			Description: "Move to the next file in a diff buffer",
+			Interactive: true,
+			Handler:     "HandleDiffFileNext",
+		},
+		{
+			Name:        "diff-file-prev",
+			Description: "Move to the previous file in a diff buffer",
+			Interactive: true,
+			Handler:     "HandleDiffFilePrev",
+		},
+		{
+			Name:        "diff-hunk-kill",
+			Description: "Remove the hunk at point from the diff",
+			Interactive: true,
+			Handler:     "HandleDiffHunkKill",
+		},
+		{
+			Name:        "diff-refresh",
+			Description: "Regenerate a buffer-diff result from the compared buffers",
+			Interactive: true,
+			Handler:     "HandleDiffRefresh",
+		},
+		{
+			Name:        "diff-goto-source",
+			Description: "Visit the source line of the diff line at point",
+			Interactive: true,
+			Handler:     "HandleDiffGotoSource",
+		},
+		{
+			Name:        "diff-fold-toggle",
+			Description: "Expand or collapse the unchanged lines or hunk at point",
+			Interactive: true,
+			Handler:     "HandleDiffFoldToggle",
+		},
+		{
+			Name:        "diff-gutter-mode",
+			Description: "Toggle markers for lines that differ from the file on disk",
+			Interactive: true,
+			Handler:     "HandleDiffGutterMode",
+		},
+		{
+			Name:        "diff-gutter-next",
+			Description: "Move to the next change against the file on disk",
+			Interactive: true,
+			Handler:     "HandleDiffGutterNext",
+		},
+		{
+			Name:        "diff-gutter-prev",
+			Description: "Move to the previous change against the file on disk",
+			Interactive: true,
+			Handler:     "HandleDiffGutterPrev",
+		},
+		{
+			Name:        "diff-gutter-revert",
+			Description: "Restore the saved version of the change at point",
+			Interactive: true,
+			Handler:     "HandleDiffGutterRevert",
+		},
+		{
+			Name:        "diff-watch-mode",
+			Description: "Toggle refreshing the diff buffer when a compared buffer changes",
+			Interactive: true,
+			Handler:     "HandleDiffWatchMode",
+		},
+		{
+			Name:        "buffer-diff-with-file",
+			Description: "Compare the current buffer with its file on disk",
+			Interactive: true,
+			Handler:     "HandleBufferDiffWithFile",
+		},
+		{
+			Name:        "compare-windows",
+			Description: "Compare the current buffer with another from both cursors, stopping at the first mismatch",
+			Interactive: true,
+			Handler:     "HandleCompareWindows",
+			ArgPrompts:  []string{"Compare with buffer (empty for the last one): "},
+		},
+		{
+			Name:        "diff-sync-scroll-mode",
+			Description: "Toggle keeping the windows of the compared buffers on corresponding lines",
+			Interactive: true,
+			Handler:     "HandleDiffSyncScrollMode",
+		},
+		{
+			Name:        "buffer-diff-history",
+			Description: "List recent comparisons to re-run one",
+			Interactive: true,
+			Handler:     "HandleBufferDiffHistory",
+		},
+		{
+			Name:        "diff-history-rerun",
+			Description: "Re-run the comparison at point in the diff history",
+			Interactive: true,
+			Handler:     "HandleDiffHistoryRerun",
+		},
+		{
+			Name:        "diff-set-option",
+			Description: "Set an option of the diff plugin",
+			Interactive: true,
+			Handler:     "HandleDiffSetOption",
+			ArgPrompts:  []string{"Diff option: ", "Value: "},
+		},
 	}
 	fmt.Printf("[PLUGIN] GetCommands returning %d commands: ", len(commands))
 	for _, cmd := range commands {
@@ -64,15 +390,76 @@ func (p *BufferDiffPlugin) GetCommands() []pluginsdk.CommandSpec {
 }
 
 func (p *BufferDiffPlugin) GetMajorModes() []pluginsdk.MajorModeSpec {
-	return []pluginsdk.MajorModeSpec{}
+	return []pluginsdk.MajorModeSpec{
+		{
+			Name:        diffMode,
+			Extensions:  []string{".diff", ".patch"},
+			Description: "Major mode for viewing and editing unified diffs",
+		},
+	}
 }
 
 func (p *BufferDiffPlugin) GetMinorModes() []pluginsdk.MinorModeSpec {
-	return []pluginsdk.MinorModeSpec{}
+	return []pluginsdk.MinorModeSpec{
+		{
+			Name:        mergeConflictMode,
+			Description: "Navigate and resolve merge conflict markers",
+		},
+		{
+			Name:        diffSessionMode,
+			Description: "Step through the differences of a buffer-diff and copy them between the buffers",
+		},
+		{
+			Name:        diffGutterMode,
+			Description: "Mark lines that differ from the file on disk",
+		},
+		{
+			Name:        diffWatchMode,
+			Description: "Refresh the diff buffer shortly after a compared buffer is edited or saved",
+		},
+		{
+			Name:        diffSyncScrollMode,
+			Description: "Scroll the windows of the compared buffers together",
+		},
+		{
+			Name:        diffHistoryMode,
+			Description: "Re-run comparisons listed by buffer-diff-history",
+		},
+	}
 }
 
 func (p *BufferDiffPlugin) GetKeyBindings() []pluginsdk.KeyBindingSpec {
-	return []pluginsdk.KeyBindingSpec{}
+	return []pluginsdk.KeyBindingSpec{
+		// Same keys as Emacs smerge-mode
+		{Sequence: "C-c ^ n", Command: "merge-next-conflict", Mode: mergeConflictMode},
+		{Sequence: "C-c ^ p", Command: "merge-prev-conflict", Mode: mergeConflictMode},
+		{Sequence: "C-c ^ m", Command: "merge-keep-mine", Mode: mergeConflictMode},
+		{Sequence: "C-c ^ o", Command: "merge-keep-theirs", Mode: mergeConflictMode},
+		{Sequence: "C-c ^ b", Command: "merge-keep-base", Mode: mergeConflictMode},
+		{Sequence: "C-c ^ a", Command: "merge-keep-both", Mode: mergeConflictMode},
+		{Sequence: "C-c ^ R", Command: "merge-refine", Mode: mergeConflictMode},
+		{Sequence: "C-c ^ r", Command: "merge-resolve-trivial", Mode: mergeConflictMode},
+		// Same keys as Emacs diff-mode
+		{Sequence: "n", Command: "diff-hunk-next", Mode: diffMode},
+		{Sequence: "p", Command: "diff-hunk-prev", Mode: diffMode},
+		{Sequence: "N", Command: "diff-file-next", Mode: diffMode},
+		{Sequence: "P", Command: "diff-file-prev", Mode: diffMode},
+		{Sequence: "k", Command: "diff-hunk-kill", Mode: diffMode},
+		{Sequence: "g", Command: "diff-refresh", Mode: diffMode},
+		{Sequence: "RET", Command: "diff-goto-source", Mode: diffMode},
+		{Sequence: "TAB", Command: "diff-fold-toggle", Mode: diffMode},
+		{Sequence: "RET", Command: "diff-history-rerun", Mode: diffHistoryMode},
+		{Sequence: "C-c C-c", Command: "diff-goto-source", Mode: diffMode},
+		// Same keys as Emacs diff-hl-mode
+		{Sequence: "C-x v ]", Command: "diff-gutter-next", Mode: diffGutterMode},
+		{Sequence: "C-x v [", Command: "diff-gutter-prev", Mode: diffGutterMode},
+		{Sequence: "C-x v n", Command: "diff-gutter-revert", Mode: diffGutterMode},
+		// Emacs ediff keys, with n and p moved under C-c to leave diff-mode's
+		{Sequence: "C-c C-n", Command: "diff-session-next", Mode: diffSessionMode},
+		{Sequence: "C-c C-p", Command: "diff-session-prev", Mode: diffSessionMode},
+		{Sequence: "a", Command: "diff-session-copy-a-to-b", Mode: diffSessionMode},
+		{Sequence: "b", Command: "diff-session-copy-b-to-a", Mode: diffSessionMode},
+	}
 }
 
 func (p *BufferDiffPlugin) HandleBufferDiff(buffer1Name, buffer2Name string) error {
@@ -83,6 +470,17 @@ func (p *BufferDiffPlugin) HandleBufferDiff(buffer1Name, buffer2Name string) err
 	fmt.Printf("[PLUGIN] HandleBufferDiff called with buffers: '%s' vs '%s'\n", buffer1Name, buffer2Name)
 	fmt.Printf("[PLUGIN] Host interface type: %T\n", p.host)
 
+	params, err := p.diffParamsFromOptions()
+	if err != nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:%v", err)
+	}
+	return p.compareBuffers(buffer1Name, buffer2Name, params)
+}
+
+// compareBuffers shows the differences between two buffers in a diff buffer
+// and records the comparison in the history.
+func (p *BufferDiffPlugin) compareBuffers(buffer1Name, buffer2Name string, params diffParams) error {
+
 	// Find both buffers
 	fmt.Printf("[PLUGIN] Searching for buffer1: '%s'\n", buffer1Name)
 	buffer1 := p.host.FindBuffer(buffer1Name)
@@ -99,13 +497,13 @@ func (p *BufferDiffPlugin) HandleBufferDiff(buffer1Name, buffer2Name string) err
 	if buffer2 == nil {
 		return fmt.Errorf("PLUGIN_MESSAGE:Buffer not found: %s", buffer2Name)
 	}
+	p.rememberCompared(buffer1Name, buffer2Name)
 
 	// Get buffer contents
 	content1 := buffer1.Content()
 	content2 := buffer2.Content()
 
-	// Perform simple line-by-line diff
-	diff := p.createSimpleDiff(buffer1Name, content1, buffer2Name, content2)
+	diff, changes := renderDiff(buffer1Name, content1, buffer2Name, content2, params)
 
 	// Create or find diff result buffer
 	diffBufferName := fmt.Sprintf("*Diff: %s <-> %s*", buffer1Name, buffer2Name)
@@ -122,6 +520,17 @@ func (p *BufferDiffPlugin) HandleBufferDiff(buffer1Name, buffer2Name string) err
 	diffBuffer.SetContent("")
 	diffContent := strings.Join(diff, "\n")
 	diffBuffer.SetContent(diffContent)
+	delete(p.folds, diffBufferName)
+	p.stopSyncScroll(diffBufferName)
+	p.startDiffSession(diffBufferName, newDiffSession(buffer1Name, content1, buffer2Name, content2, changes, params))
+	p.setDiffMode(diffBufferName, diffContent)
+	if p.watchedDiff(diffBufferName) || p.boolOption("diff-auto-refresh", false) {
+		if err := p.watchDiff(diffBufferName); err != nil {
+			fmt.Printf("[PLUGIN] Failed to watch '%s': %v\n", diffBufferName, err)
+		}
+	}
+
+	p.recordComparison(buffer1, buffer2, params)
 
 	// Switch to diff buffer
 	err := p.host.SwitchToBuffer(diffBufferName)
@@ -129,7 +538,13 @@ func (p *BufferDiffPlugin) HandleBufferDiff(buffer1Name, buffer2Name string) err
 		return fmt.Errorf("PLUGIN_MESSAGE:Failed to switch to diff buffer: %v", err)
 	}
 
-	return fmt.Errorf("PLUGIN_MESSAGE:Buffer diff completed: %d differences found", p.countDifferences(diff))
+	message := fmt.Sprintf("Buffer diff completed: %d differences found", len(changes))
+	if len(changes) == 0 {
+		diffBuffer.SetCursorPosition(0)
+		return fmt.Errorf("PLUGIN_MESSAGE:%s", message)
+	}
+	lineA, lineB := p.landOnFirstChange(diffBuffer, buffer1, buffer2, changes[0])
+	return fmt.Errorf("PLUGIN_MESSAGE:%s, first at line %d of %s and line %d of %s", message, lineA+1, buffer1Name, lineB+1, buffer2Name)
 }
 
 func (p *BufferDiffPlugin) HandleBufferDiffCurrent(otherBufferName string) error {
@@ -149,62 +564,18 @@ func (p *BufferDiffPlugin) HandleBufferDiffCurrent(otherBufferName string) error
 	return p.HandleBufferDiff(currentBufferName, otherBufferName)
 }
 
+// createSimpleDiff returns the full listing of content1 against content2
+// with the default parameters.
 func (p *BufferDiffPlugin) createSimpleDiff(name1, content1, name2, content2 string) []string {
-	lines1 := strings.Split(content1, "\n")
-	lines2 := strings.Split(content2, "\n")
-
-	var result []string
-	
-	// Add header
-	result = append(result, fmt.Sprintf("--- %s", name1))
-	result = append(result, fmt.Sprintf("+++ %s", name2))
-	result = append(result, "")
-
-	maxLines := len(lines1)
-	if len(lines2) > maxLines {
-		maxLines = len(lines2)
-	}
-
-	// Simple line-by-line comparison
-	for i := 0; i < maxLines; i++ {
-		line1 := ""
-		line2 := ""
-
-		if i < len(lines1) {
-			line1 = lines1[i]
-		}
-		if i < len(lines2) {
-			line2 = lines2[i]
-		}
-
-		if line1 == line2 {
-			result = append(result, fmt.Sprintf(" %s", line1))
-		} else {
-			if line1 != "" {
-				result = append(result, fmt.Sprintf("-%s", line1))
-			}
-			if line2 != "" {
-				result = append(result, fmt.Sprintf("+%s", line2))
-			}
-		}
-	}
-
-	return result
-}
-
-func (p *BufferDiffPlugin) countDifferences(diff []string) int {
-	count := 0
-	for _, line := range diff {
-		if strings.HasPrefix(line, "-") || strings.HasPrefix(line, "+") {
-			count++
-		}
-	}
-	return count
+	diff, _ := renderDiff(name1, content1, name2, content2, defaultDiffParams)
+	return diff
 }
 
 // CommandPlugin インターフェース実装
 func (p *BufferDiffPlugin) ExecuteCommand(name string, args ...interface{}) error {
 	fmt.Printf("[PLUGIN] ExecuteCommand called: %s with %d args: %v\n", name, len(args), args)
+	p.execMu.Lock()
+	defer p.execMu.Unlock()
 
 	switch name {
 	case "buffer-diff":
@@ -224,13 +595,138 @@ func (p *BufferDiffPlugin) ExecuteCommand(name string, args ...interface{}) erro
 			}
 		}
 		return fmt.Errorf("PLUGIN_MESSAGE:buffer-diff-current requires 1 buffer name")
+	case "patch-apply", "patch-apply-partial", "patch-apply-reverse":
+		if len(args) >= 2 {
+			patchBuffer, ok1 := args[0].(string)
+			target, ok2 := args[1].(string)
+			if ok1 && ok2 {
+				switch name {
+				case "patch-apply-partial":
+					return p.HandlePatchApplyPartial(patchBuffer, target)
+				case "patch-apply-reverse":
+					return p.HandlePatchApplyReverse(patchBuffer, target)
+				}
+				return p.HandlePatchApply(patchBuffer, target)
+			}
+		}
+		return fmt.Errorf("PLUGIN_MESSAGE:%s requires a patch buffer and a target buffer", name)
+	case "patch-apply-files", "patch-apply-files-partial":
+		if len(args) >= 1 {
+			patchBuffer, ok := args[0].(string)
+			baseDir := ""
+			if len(args) >= 2 {
+				baseDir, _ = args[1].(string)
+			}
+			if ok {
+				if name == "patch-apply-files-partial" {
+					return p.HandlePatchApplyFilesPartial(patchBuffer, baseDir)
+				}
+				return p.HandlePatchApplyFiles(patchBuffer, baseDir)
+			}
+		}
+		return fmt.Errorf("PLUGIN_MESSAGE:%s requires a patch buffer", name)
+	case "diff-hunk-copy-to-a":
+		return p.HandleDiffHunkCopyToA()
+	case "diff-hunk-copy-to-b", "diff-hunk-revert":
+		return p.HandleDiffHunkCopyToB()
+	case "diff-split-hunk":
+		return p.HandleDiffSplitHunk()
+	case "diff-recount-hunks":
+		return p.HandleDiffRecountHunks()
+	case "buffer-merge3":
+		if len(args) >= 3 {
+			mine, ok1 := args[0].(string)
+			base, ok2 := args[1].(string)
+			theirs, ok3 := args[2].(string)
+			if ok1 && ok2 && ok3 {
+				return p.HandleBufferMerge3(mine, base, theirs)
+			}
+		}
+		return fmt.Errorf("PLUGIN_MESSAGE:buffer-merge3 requires 3 buffer names")
+	case "merge-conflict-mode":
+		return p.HandleMergeConflictMode()
+	case "merge-next-conflict":
+		return p.HandleMergeNextConflict()
+	case "merge-prev-conflict":
+		return p.HandleMergePrevConflict()
+	case "merge-keep-mine":
+		return p.HandleMergeKeepMine()
+	case "merge-keep-theirs":
+		return p.HandleMergeKeepTheirs()
+	case "merge-keep-base":
+		return p.HandleMergeKeepBase()
+	case "merge-keep-both":
+		return p.HandleMergeKeepBoth()
+	case "merge-refine":
+		return p.HandleMergeRefine()
+	case "merge-resolve-trivial":
+		return p.HandleMergeResolveTrivial()
+	case "diff-session-next":
+		return p.HandleDiffSessionNext()
+	case "diff-session-prev":
+		return p.HandleDiffSessionPrev()
+	case "diff-session-copy-a-to-b":
+		return p.HandleDiffSessionCopyAToB()
+	case "diff-session-copy-b-to-a":
+		return p.HandleDiffSessionCopyBToA()
+	case "diff-hunk-next":
+		return p.HandleDiffHunkNext()
+	case "diff-hunk-prev":
+		return p.HandleDiffHunkPrev()
+	case "diff-file-next":
+		return p.HandleDiffFileNext()
+	case "diff-file-prev":
+		return p.HandleDiffFilePrev()
+	case "diff-hunk-kill":
+		return p.HandleDiffHunkKill()
+	case "diff-refresh":
+		return p.HandleDiffRefresh()
+	case "diff-goto-source":
+		return p.HandleDiffGotoSource()
+	case "diff-fold-toggle":
+		return p.HandleDiffFoldToggle()
+	case "diff-gutter-mode":
+		return p.HandleDiffGutterMode()
+	case "diff-gutter-next":
+		return p.HandleDiffGutterNext()
+	case "diff-gutter-prev":
+		return p.HandleDiffGutterPrev()
+	case "diff-gutter-revert":
+		return p.HandleDiffGutterRevert()
+	case "diff-watch-mode":
+		return p.HandleDiffWatchMode()
+	case "buffer-diff-with-file":
+		return p.HandleBufferDiffWithFile()
+	case "compare-windows":
+		otherBuffer := ""
+		if len(args) >= 1 {
+			otherBuffer, _ = args[0].(string)
+		}
+		return p.HandleCompareWindows(otherBuffer)
+	case "diff-sync-scroll-mode":
+		return p.HandleDiffSyncScrollMode()
+	case "buffer-diff-history":
+		return p.HandleBufferDiffHistory()
+	case "diff-history-rerun":
+		return p.HandleDiffHistoryRerun()
+	case "diff-set-option":
+		if len(args) >= 2 {
+			name, ok1 := args[0].(string)
+			value, ok2 := args[1].(string)
+			if ok1 && ok2 {
+				return p.HandleDiffSetOption(name, value)
+			}
+		}
+		return fmt.Errorf("PLUGIN_MESSAGE:diff-set-option requires an option name and a value")
 	default:
 		return fmt.Errorf("unknown command: %s", name)
 	}
 }
 
+// GetCompletions completes the first prompt of command. Hosts that know
+// which prompt is being answered call GetPromptCompletions.
 func (p *BufferDiffPlugin) GetCompletions(command string, prefix string) []string {
-	return []string{}
+	return p.GetPromptCompletions(command, 0, nil, prefix)
 }
 
 var pluginInstance = &BufferDiffPlugin{}
@@ -253,6 +749,7 @@ func (p *RPCPlugin) Client(b *plugin.MuxBroker, c *rpc.Client) (interface{}, err
 type RPCServer struct {
 	Impl   pluginsdk.Plugin
 	broker *plugin.MuxBroker
+	host   *RPCHostClient
 }
 
 // RPCClient はホスト側のRPCクライアント
@@ -307,7 +804,7 @@ func (c *RPCClient) Initialize(ctx context.Context, host pluginsdk.HostInterface
 		
 		// Create RPC server and register Host service
 		server := rpc.NewServer()
-		err = server.RegisterName("Host", &RPCHostServer{Impl: host})
+		err = server.RegisterName("Host", &RPCHostServer{Impl: host, plugin: c.client})
 		if err != nil {
 			fmt.Printf("[RPC] Failed to register Host service: %v\n", err)
 			return
@@ -382,6 +879,20 @@ func (c *RPCClient) GetKeyBindings() []pluginsdk.KeyBindingSpec {
 	return resp
 }
 
+// CommandPlugin インターフェースの補完部分の実装（RPCClient）
+func (c *RPCClient) GetCompletions(command string, prefix string) []string {
+	return c.GetPromptCompletions(command, 0, nil, prefix)
+}
+
+func (c *RPCClient) GetPromptCompletions(command string, prompt int, args []string, prefix string) []string {
+	var resp []string
+	err := c.client.Call("Plugin.GetCompletions", CompletionArgs{Command: command, Prompt: prompt, Args: args, Prefix: prefix}, &resp)
+	if err != nil {
+		return []string{}
+	}
+	return resp
+}
+
 // RPCServer Plugin インターフェースの実装
 func (s *RPCServer) Name(args interface{}, resp *string) error {
 	*resp = s.Impl.Name()
@@ -423,6 +934,7 @@ func (s *RPCServer) Initialize(args map[string]interface{}, resp *error) error {
 	
 	// Create RPC client for host interface
 	hostClient := &RPCHostClient{client: rpc.NewClient(conn)}
+	s.host = hostClient
 	
 	fmt.Printf("[RPC-Server] Created host RPC client, initializing plugin\n")
 	
@@ -495,9 +1007,37 @@ func (s *RPCServer) ExecuteCommand(args map[string]interface{}, resp *string) er
 	return nil
 }
 
+// GetCompletions はプロンプトの補完候補を返す
+func (s *RPCServer) GetCompletions(args CompletionArgs, resp *[]string) error {
+	switch impl := s.Impl.(type) {
+	case promptCompleter:
+		*resp = impl.GetPromptCompletions(args.Command, args.Prompt, args.Args, args.Prefix)
+	case pluginsdk.CommandPlugin:
+		*resp = impl.GetCompletions(args.Command, args.Prefix)
+	default:
+		*resp = []string{}
+	}
+	return nil
+}
+
+// RunHook はホストで発火したフックをプラグイン側のハンドラに渡す
+func (s *RPCServer) RunHook(args HookArgs, resp *error) error {
+	if s.host == nil {
+		*resp = fmt.Errorf("plugin is not initialized")
+		return nil
+	}
+	*resp = s.host.runHook(args.ID, args.Args...)
+	return nil
+}
+
 // RPCHostClient はプラグイン側でホストの機能をRPC経由で呼び出すクライアント
 type RPCHostClient struct {
 	client *rpc.Client
+
+	// フックハンドラはプラグイン側に残し、ホストにはIDだけを登録する
+	hooksMu    sync.Mutex
+	hooks      map[int]func(...interface{}) error
+	nextHookID int
 }
 
 // BufferInfo represents buffer state for RPC transmission
@@ -509,6 +1049,59 @@ type BufferInfo struct {
 	Filename string
 }
 
+// BufferEditArgs carries a buffer modification for RPC transmission
+type BufferEditArgs struct {
+	Name    string
+	Content string
+	Start   int
+	End     int
+}
+
+// ModeArgs names a buffer and a mode for RPC transmission
+type ModeArgs struct {
+	Buffer string
+	Mode   string
+}
+
+// OptionArgs carries an option assignment for RPC transmission. Value must
+// be a type gob knows: a basic type or a slice of one.
+type OptionArgs struct {
+	Name  string
+	Value interface{}
+}
+
+// HookArgs carries a hook registration or invocation for RPC transmission.
+// ID names the plugin-side handler; Args must be types gob knows.
+type HookArgs struct {
+	Event string
+	ID    int
+	Args  []interface{}
+}
+
+// CompletionArgs carries a completion request for RPC transmission. Prompt
+// is the index of the ArgPrompt being answered and Args the answers given
+// to the prompts before it.
+type CompletionArgs struct {
+	Command string
+	Prompt  int
+	Args    []string
+	Prefix  string
+}
+
+// WindowInfo represents window state for RPC transmission
+type WindowInfo struct {
+	Buffer       BufferInfo
+	Width        int
+	Height       int
+	ScrollOffset int
+}
+
+// WindowScrollArgs scrolls the window showing Buffer for RPC transmission
+type WindowScrollArgs struct {
+	Buffer string
+	Offset int
+}
+
 // RPCBufferProxy provides a client-side proxy for buffer operations via RPC
 type RPCBufferProxy struct {
 	client *rpc.Client
@@ -523,20 +1116,44 @@ func (b *RPCBufferProxy) Filename() string       { return b.info.Filename }
 
 func (b *RPCBufferProxy) SetContent(content string) {
 	b.info.Content = content
-	// TODO: Implement RPC call to sync content to host
+	var resp error
+	err := b.client.Call("Host.SetBufferContent", BufferEditArgs{Name: b.info.Name, Content: content}, &resp)
+	if err != nil {
+		fmt.Printf("[RPC] SetBufferContent call failed: %v\n", err)
+	}
 }
 
 func (b *RPCBufferProxy) InsertAt(pos int, text string) {
-	// TODO: Implement RPC call to insert text at position
+	runes := []rune(b.info.Content)
+	if pos >= 0 && pos <= len(runes) {
+		b.info.Content = string(runes[:pos]) + text + string(runes[pos:])
+	}
+	var resp error
+	err := b.client.Call("Host.InsertText", BufferEditArgs{Name: b.info.Name, Content: text, Start: pos}, &resp)
+	if err != nil {
+		fmt.Printf("[RPC] InsertText call failed: %v\n", err)
+	}
 }
 
 func (b *RPCBufferProxy) DeleteRange(start, end int) {
-	// TODO: Implement RPC call to delete text range
+	runes := []rune(b.info.Content)
+	if start >= 0 && start <= end && end <= len(runes) {
+		b.info.Content = string(runes[:start]) + string(runes[end:])
+	}
+	var resp error
+	err := b.client.Call("Host.DeleteRange", BufferEditArgs{Name: b.info.Name, Start: start, End: end}, &resp)
+	if err != nil {
+		fmt.Printf("[RPC] DeleteRange call failed: %v\n", err)
+	}
 }
 
 func (b *RPCBufferProxy) SetCursorPosition(pos int) {
 	b.info.Position = pos
-	// TODO: Implement RPC call to sync cursor position to host
+	var resp error
+	err := b.client.Call("Host.SetCursorPosition", BufferEditArgs{Name: b.info.Name, Start: pos}, &resp)
+	if err != nil {
+		fmt.Printf("[RPC] SetCursorPosition call failed: %v\n", err)
+	}
 }
 
 func (b *RPCBufferProxy) MarkDirty() {
@@ -544,6 +1161,29 @@ func (b *RPCBufferProxy) MarkDirty() {
 	// TODO: Implement RPC call to mark buffer dirty on host
 }
 
+// RPCWindowProxy provides a client-side proxy for window operations via RPC.
+// Windows are addressed by the buffer they show.
+type RPCWindowProxy struct {
+	client *rpc.Client
+	info   WindowInfo
+}
+
+func (w *RPCWindowProxy) Buffer() pluginsdk.BufferInterface {
+	return &RPCBufferProxy{client: w.client, info: w.info.Buffer}
+}
+func (w *RPCWindowProxy) Width() int        { return w.info.Width }
+func (w *RPCWindowProxy) Height() int       { return w.info.Height }
+func (w *RPCWindowProxy) ScrollOffset() int { return w.info.ScrollOffset }
+
+func (w *RPCWindowProxy) SetScrollOffset(offset int) {
+	w.info.ScrollOffset = offset
+	var resp error
+	err := w.client.Call("Host.SetWindowScroll", WindowScrollArgs{Buffer: w.info.Buffer.Name, Offset: offset}, &resp)
+	if err != nil {
+		fmt.Printf("[RPC] SetWindowScroll call failed: %v\n", err)
+	}
+}
+
 // HostInterface implementation for RPC client
 func (h *RPCHostClient) GetCurrentBuffer() pluginsdk.BufferInterface {
 	var resp BufferInfo
@@ -560,8 +1200,30 @@ func (h *RPCHostClient) GetCurrentBuffer() pluginsdk.BufferInterface {
 }
 
 func (h *RPCHostClient) GetCurrentWindow() pluginsdk.WindowInterface {
-	// TODO: Implement RPC call to host
-	return nil
+	var resp WindowInfo
+	err := h.client.Call("Host.GetCurrentWindow", interface{}(nil), &resp)
+	if err != nil {
+		fmt.Printf("[RPC] GetCurrentWindow call failed: %v\n", err)
+		return nil
+	}
+	if resp.Buffer.Name == "" {
+		return nil
+	}
+	return &RPCWindowProxy{client: h.client, info: resp}
+}
+
+// FindWindow returns a window showing bufferName, or nil when none does.
+func (h *RPCHostClient) FindWindow(bufferName string) pluginsdk.WindowInterface {
+	var resp WindowInfo
+	err := h.client.Call("Host.FindWindow", bufferName, &resp)
+	if err != nil {
+		fmt.Printf("[RPC] FindWindow call failed: %v\n", err)
+		return nil
+	}
+	if resp.Buffer.Name == "" {
+		return nil
+	}
+	return &RPCWindowProxy{client: h.client, info: resp}
 }
 
 func (h *RPCHostClient) SetStatus(message string) {
@@ -580,21 +1242,59 @@ func (h *RPCHostClient) ExecuteCommand(name string, args ...interface{}) error {
 }
 
 func (h *RPCHostClient) SetMajorMode(bufferName, modeName string) error {
-	// TODO: Implement RPC call to host
-	return fmt.Errorf("SetMajorMode not implemented in RPC client")
+	var resp error
+	err := h.client.Call("Host.SetMajorMode", ModeArgs{Buffer: bufferName, Mode: modeName}, &resp)
+	if err != nil {
+		return fmt.Errorf("RPC call failed: %v", err)
+	}
+	return resp
 }
 
 func (h *RPCHostClient) ToggleMinorMode(bufferName, modeName string) error {
-	// TODO: Implement RPC call to host
-	return fmt.Errorf("ToggleMinorMode not implemented in RPC client")
+	var resp error
+	err := h.client.Call("Host.ToggleMinorMode", ModeArgs{Buffer: bufferName, Mode: modeName}, &resp)
+	if err != nil {
+		return fmt.Errorf("RPC call failed: %v", err)
+	}
+	return resp
 }
 
 func (h *RPCHostClient) AddHook(event string, handler func(...interface{}) error) {
-	// TODO: Implement RPC call to host
+	h.hooksMu.Lock()
+	if h.hooks == nil {
+		h.hooks = map[int]func(...interface{}) error{}
+	}
+	h.nextHookID++
+	id := h.nextHookID
+	h.hooks[id] = handler
+	h.hooksMu.Unlock()
+
+	var resp error
+	err := h.client.Call("Host.AddHook", HookArgs{Event: event, ID: id}, &resp)
+	if err == nil {
+		err = resp
+	}
+	if err != nil {
+		fmt.Printf("[RPC] AddHook %s failed: %v\n", event, err)
+	}
+}
+
+// runHook calls the handler registered under id when the host fires its hook.
+func (h *RPCHostClient) runHook(id int, args ...interface{}) error {
+	h.hooksMu.Lock()
+	handler := h.hooks[id]
+	h.hooksMu.Unlock()
+	if handler == nil {
+		return fmt.Errorf("unknown hook handler: %d", id)
+	}
+	return handler(args...)
 }
 
 func (h *RPCHostClient) TriggerHook(event string, args ...interface{}) {
-	// TODO: Implement RPC call to host
+	var resp error
+	if err := h.client.Call("Host.TriggerHook", HookArgs{Event: event, Args: args}, &resp); err != nil {
+		fmt.Printf("[RPC] TriggerHook %s failed: %v\n", event, err)
+	}
 }
 
 func (h *RPCHostClient) CreateBuffer(name string) pluginsdk.BufferInterface {
@@ -635,6 +1335,18 @@ func (h *RPCHostClient) FindBuffer(name string) pluginsdk.BufferInterface {
 	}
 }
 
+// ListBuffers returns the names of the host's buffers, or nil when the host
+// cannot list them.
+func (h *RPCHostClient) ListBuffers() []string {
+	var resp []string
+	err := h.client.Call("Host.ListBuffers", interface{}(nil), &resp)
+	if err != nil {
+		fmt.Printf("[RPC] ListBuffers call failed: %v\n", err)
+		return nil
+	}
+	return resp
+}
+
 func (h *RPCHostClient) SwitchToBuffer(name string) error {
 	var resp error
 	err := h.client.Call("Host.SwitchToBuffer", name, &resp)
@@ -677,18 +1389,28 @@ func (h *RPCHostClient) SaveBuffer(bufferName string) error {
 }
 
 func (h *RPCHostClient) GetOption(name string) (interface{}, error) {
-	// TODO: Implement RPC call to host
-	return nil, fmt.Errorf("GetOption not implemented in RPC client")
+	var resp interface{}
+	err := h.client.Call("Host.GetOption", name, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
 }
 
 func (h *RPCHostClient) SetOption(name string, value interface{}) error {
-	// TODO: Implement RPC call to host
-	return fmt.Errorf("SetOption not implemented in RPC client")
+	var resp error
+	err := h.client.Call("Host.SetOption", OptionArgs{Name: name, Value: value}, &resp)
+	if err != nil {
+		return fmt.Errorf("RPC call failed: %v", err)
+	}
+	return resp
 }
 
 // RPCHostServer はgmacs側でホスト機能をRPC経由で提供するサーバー
 type RPCHostServer struct {
 	Impl pluginsdk.HostInterface
+	// plugin はフック発火時にプラグインを呼び出すためのクライアント
+	plugin *rpc.Client
 }
 
 func (h *RPCHostServer) SetStatus(message string, resp *error) error {
@@ -766,6 +1488,179 @@ func (h *RPCHostServer) GetCurrentBuffer(args interface{}, resp *BufferInfo) err
 	return nil
 }
 
+// windowInfo packs a window for RPC transmission
+func windowInfo(window pluginsdk.WindowInterface) WindowInfo {
+	info := WindowInfo{
+		Width:        window.Width(),
+		Height:       window.Height(),
+		ScrollOffset: window.ScrollOffset(),
+	}
+	if buffer := window.Buffer(); buffer != nil {
+		info.Buffer = BufferInfo{
+			Name:     buffer.Name(),
+			Content:  buffer.Content(),
+			Position: buffer.CursorPosition(),
+			IsDirty:  buffer.IsDirty(),
+			Filename: buffer.Filename(),
+		}
+	}
+	return info
+}
+
+// findWindow returns the current window when it shows bufferName, or a
+// window showing it found by the host
+func (h *RPCHostServer) findWindow(bufferName string) pluginsdk.WindowInterface {
+	if window := h.Impl.GetCurrentWindow(); window != nil && window.Buffer() != nil && window.Buffer().Name() == bufferName {
+		return window
+	}
+	if finder, ok := h.Impl.(windowFinder); ok {
+		return finder.FindWindow(bufferName)
+	}
+	return nil
+}
+
+// GetCurrentWindow handles RPC calls from plugins to get the current window
+func (h *RPCHostServer) GetCurrentWindow(args interface{}, resp *WindowInfo) error {
+	window := h.Impl.GetCurrentWindow()
+	if window == nil {
+		*resp = WindowInfo{}
+		return nil
+	}
+	*resp = windowInfo(window)
+	return nil
+}
+
+// FindWindow handles RPC calls from plugins to find the window showing a buffer
+func (h *RPCHostServer) FindWindow(bufferName string, resp *WindowInfo) error {
+	window := h.findWindow(bufferName)
+	if window == nil {
+		*resp = WindowInfo{}
+		return nil
+	}
+	*resp = windowInfo(window)
+	return nil
+}
+
+// SetWindowScroll handles RPC calls from plugins to scroll a window
+func (h *RPCHostServer) SetWindowScroll(args WindowScrollArgs, resp *error) error {
+	window := h.findWindow(args.Buffer)
+	if window == nil {
+		*resp = fmt.Errorf("no window shows buffer %s", args.Buffer)
+		return nil
+	}
+	window.SetScrollOffset(args.Offset)
+	*resp = nil
+	return nil
+}
+
+// SetBufferContent handles RPC calls from plugins to replace buffer content
+func (h *RPCHostServer) SetBufferContent(args BufferEditArgs, resp *error) error {
+	buffer := h.Impl.FindBuffer(args.Name)
+	if buffer == nil {
+		*resp = fmt.Errorf("buffer not found: %s", args.Name)
+		return nil
+	}
+	buffer.SetContent(args.Content)
+	*resp = nil
+	return nil
+}
+
+// InsertText handles RPC calls from plugins to insert text into a buffer
+func (h *RPCHostServer) InsertText(args BufferEditArgs, resp *error) error {
+	buffer := h.Impl.FindBuffer(args.Name)
+	if buffer == nil {
+		*resp = fmt.Errorf("buffer not found: %s", args.Name)
+		return nil
+	}
+	buffer.InsertAt(args.Start, args.Content)
+	*resp = nil
+	return nil
+}
+
+// DeleteRange handles RPC calls from plugins to delete text from a buffer
+func (h *RPCHostServer) DeleteRange(args BufferEditArgs, resp *error) error {
+	buffer := h.Impl.FindBuffer(args.Name)
+	if buffer == nil {
+		*resp = fmt.Errorf("buffer not found: %s", args.Name)
+		return nil
+	}
+	buffer.DeleteRange(args.Start, args.End)
+	*resp = nil
+	return nil
+}
+
+// SetCursorPosition handles RPC calls from plugins to move a buffer's cursor
+func (h *RPCHostServer) SetCursorPosition(args BufferEditArgs, resp *error) error {
+	buffer := h.Impl.FindBuffer(args.Name)
+	if buffer == nil {
+		*resp = fmt.Errorf("buffer not found: %s", args.Name)
+		return nil
+	}
+	buffer.SetCursorPosition(args.Start)
+	*resp = nil
+	return nil
+}
+
+// ToggleMinorMode handles RPC calls from plugins to toggle minor modes
+func (h *RPCHostServer) ToggleMinorMode(args ModeArgs, resp *error) error {
+	*resp = h.Impl.ToggleMinorMode(args.Buffer, args.Mode)
+	return nil
+}
+
+// SetMajorMode handles RPC calls from plugins to set major modes
+func (h *RPCHostServer) SetMajorMode(args ModeArgs, resp *error) error {
+	*resp = h.Impl.SetMajorMode(args.Buffer, args.Mode)
+	return nil
+}
+
+// SetOption handles RPC calls from plugins to set host options
+func (h *RPCHostServer) SetOption(args OptionArgs, resp *error) error {
+	*resp = h.Impl.SetOption(args.Name, args.Value)
+	return nil
+}
+
+// AddHook handles RPC calls from plugins to add hooks. The host calls back
+// into the plugin, which runs the handler registered under args.ID.
+func (h *RPCHostServer) AddHook(args HookArgs, resp *error) error {
+	event, id := args.Event, args.ID
+	h.Impl.AddHook(event, func(hookArgs ...interface{}) error {
+		var resp error
+		if err := h.plugin.Call("Plugin.RunHook", HookArgs{Event: event, ID: id, Args: hookArgs}, &resp); err != nil {
+			return fmt.Errorf("RPC call failed: %v", err)
+		}
+		return resp
+	})
+	*resp = nil
+	return nil
+}
+
+// TriggerHook handles RPC calls from plugins to fire hooks
+func (h *RPCHostServer) TriggerHook(args HookArgs, resp *error) error {
+	h.Impl.TriggerHook(args.Event, args.Args...)
+	*resp = nil
+	return nil
+}
+
+// GetOption handles RPC calls from plugins to read host options
+func (h *RPCHostServer) GetOption(name string, resp *interface{}) error {
+	value, err := h.Impl.GetOption(name)
+	if err != nil {
+		return err
+	}
+	*resp = value
+	return nil
+}
+
+// ListBuffers handles RPC calls from plugins to list buffer names
+func (h *RPCHostServer) ListBuffers(args interface{}, resp *[]string) error {
+	lister, ok := h.Impl.(bufferLister)
+	if !ok {
+		return fmt.Errorf("host does not support listing buffers")
+	}
+	*resp = lister.ListBuffers()
+	return nil
+}
+
 // SwitchToBuffer handles RPC calls from plugins to switch buffers
 func (h *RPCHostServer) SwitchToBuffer(name string, resp *error) error {
 	*resp = h.Impl.SwitchToBuffer(name)
@@ -1,7 +1,13 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
 	"testing"
+	"unicode/utf8"
+
 	pluginsdk "github.com/TakahashiShuuhei/gmacs-plugin-sdk"
 )
 
@@ -10,8 +16,8 @@ func TestBufferDiffPluginGetCommands(t *testing.T) {
 	
 	commands := plugin.GetCommands()
 	
-	if len(commands) != 2 {
-		t.Errorf("Expected 2 commands, got %d", len(commands))
+	if len(commands) != 45 {
+		t.Errorf("Expected 45 commands, got %d", len(commands))
 	}
 	
 	// Test buffer-diff command
@@ -97,4 +103,230 @@ func findCommand(commands []pluginsdk.CommandSpec, name string) *pluginsdk.Comma
 		}
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+// mockBuffer is an in-memory BufferInterface used by handler tests.
+type mockBuffer struct {
+	name     string
+	content  string
+	cursor   int
+	dirty    bool
+	filename string
+}
+
+func (b *mockBuffer) Name() string        { return b.name }
+func (b *mockBuffer) Content() string     { return b.content }
+func (b *mockBuffer) CursorPosition() int { return b.cursor }
+func (b *mockBuffer) IsDirty() bool       { return b.dirty }
+func (b *mockBuffer) Filename() string    { return b.filename }
+func (b *mockBuffer) MarkDirty()          { b.dirty = true }
+
+func (b *mockBuffer) SetContent(content string) {
+	b.content = content
+	b.dirty = true
+}
+
+func (b *mockBuffer) InsertAt(pos int, text string) {
+	runes := []rune(b.content)
+	b.content = string(runes[:pos]) + text + string(runes[pos:])
+	b.dirty = true
+}
+
+func (b *mockBuffer) DeleteRange(start, end int) {
+	runes := []rune(b.content)
+	b.content = string(runes[:start]) + string(runes[end:])
+	b.dirty = true
+}
+
+func (b *mockBuffer) SetCursorPosition(pos int) {
+	if pos > utf8.RuneCountInString(b.content) {
+		pos = utf8.RuneCountInString(b.content)
+	}
+	b.cursor = pos
+}
+
+// mockHost is an in-memory HostInterface used by handler tests.
+type mockHost struct {
+	buffers map[string]*mockBuffer
+	current string
+	options map[string]interface{}
+
+	majorModes map[string]string
+	minorModes map[string]bool
+	hooks      map[string][]func(...interface{}) error
+	windows    []*mockWindow
+}
+
+// mockWindow is a window of mockHost showing one buffer.
+type mockWindow struct {
+	buffer *mockBuffer
+	height int
+	scroll int
+}
+
+func (w *mockWindow) Buffer() pluginsdk.BufferInterface { return w.buffer }
+func (w *mockWindow) Width() int                        { return 80 }
+func (w *mockWindow) Height() int                       { return w.height }
+func (w *mockWindow) ScrollOffset() int                 { return w.scroll }
+func (w *mockWindow) SetScrollOffset(offset int)        { w.scroll = offset }
+
+func newMockHost(buffers ...*mockBuffer) *mockHost {
+	// History is off, since it would be saved to the user's config
+	// directory.
+	h := &mockHost{
+		buffers:    map[string]*mockBuffer{},
+		options:    map[string]interface{}{"diff-history-size": 0},
+		majorModes: map[string]string{},
+		minorModes: map[string]bool{},
+		hooks:      map[string][]func(...interface{}) error{},
+	}
+	for _, b := range buffers {
+		h.buffers[b.name] = b
+		if h.current == "" {
+			h.current = b.name
+		}
+	}
+	return h
+}
+
+func (h *mockHost) GetCurrentBuffer() pluginsdk.BufferInterface {
+	if b, ok := h.buffers[h.current]; ok {
+		return b
+	}
+	return nil
+}
+
+func (h *mockHost) GetCurrentWindow() pluginsdk.WindowInterface {
+	if w := h.FindWindow(h.current); w != nil {
+		return w
+	}
+	return nil
+}
+
+func (h *mockHost) FindWindow(bufferName string) pluginsdk.WindowInterface {
+	for _, w := range h.windows {
+		if w.buffer.name == bufferName {
+			return w
+		}
+	}
+	return nil
+}
+
+func (h *mockHost) SetStatus(message string)   {}
+func (h *mockHost) ShowMessage(message string) {}
+
+func (h *mockHost) ExecuteCommand(name string, args ...interface{}) error {
+	return fmt.Errorf("unknown command: %s", name)
+}
+
+func (h *mockHost) SetMajorMode(bufferName, modeName string) error {
+	h.majorModes[bufferName] = modeName
+	return nil
+}
+
+func (h *mockHost) ToggleMinorMode(bufferName, modeName string) error {
+	key := bufferName + " " + modeName
+	h.minorModes[key] = !h.minorModes[key]
+	return nil
+}
+
+func (h *mockHost) AddHook(event string, handler func(...interface{}) error) {
+	h.hooks[event] = append(h.hooks[event], handler)
+}
+
+func (h *mockHost) TriggerHook(event string, args ...interface{}) {
+	for _, handler := range h.hooks[event] {
+		handler(args...)
+	}
+}
+
+func (h *mockHost) CreateBuffer(name string) pluginsdk.BufferInterface {
+	b := &mockBuffer{name: name}
+	h.buffers[name] = b
+	return b
+}
+
+func (h *mockHost) ListBuffers() []string {
+	names := make([]string, 0, len(h.buffers))
+	for name := range h.buffers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// killBuffer runs the kill-buffer hook for name, then removes the buffer
+// and its minor modes.
+func (h *mockHost) killBuffer(name string) {
+	h.TriggerHook(hookKillBuffer, name)
+	delete(h.buffers, name)
+	for key := range h.minorModes {
+		if strings.HasPrefix(key, name+" ") {
+			delete(h.minorModes, key)
+		}
+	}
+}
+
+func (h *mockHost) FindBuffer(name string) pluginsdk.BufferInterface {
+	if b, ok := h.buffers[name]; ok {
+		return b
+	}
+	return nil
+}
+
+func (h *mockHost) SwitchToBuffer(name string) error {
+	if _, ok := h.buffers[name]; !ok {
+		return fmt.Errorf("buffer not found: %s", name)
+	}
+	h.current = name
+	return nil
+}
+
+// OpenFile visits path in a buffer named after it, starting empty when the
+// file does not exist yet.
+func (h *mockHost) OpenFile(path string) error {
+	for _, b := range h.buffers {
+		if b.filename == path {
+			h.current = b.name
+			return nil
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	b := &mockBuffer{name: path, content: string(data), filename: path}
+	h.buffers[b.name] = b
+	h.current = b.name
+	return nil
+}
+
+func (h *mockHost) SaveBuffer(bufferName string) error {
+	b, ok := h.buffers[bufferName]
+	if !ok {
+		return fmt.Errorf("buffer not found: %s", bufferName)
+	}
+	if b.filename != "" {
+		if err := os.WriteFile(b.filename, []byte(b.content), 0644); err != nil {
+			return err
+		}
+	}
+	b.dirty = false
+	return nil
+}
+
+func (h *mockHost) GetOption(name string) (interface{}, error) {
+	if v, ok := h.options[name]; ok {
+		return v, nil
+	}
+	return nil, fmt.Errorf("unknown option: %s", name)
+}
+
+func (h *mockHost) SetOption(name string, value interface{}) error {
+	if value == nil {
+		delete(h.options, name)
+		return nil
+	}
+	h.options[name] = value
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Diff algorithms accepted by the diff-algorithm option.
+const (
+	algorithmMyers    = "myers"
+	algorithmPatience = "patience"
+)
+
+// diffParams are the settings a *Diff* buffer was produced with. They are
+// read from host options when buffer-diff runs and kept with the buffer, so
+// diff-refresh reproduces the same kind of diff.
+type diffParams struct {
+	algorithm        string
+	ignoreWhitespace bool
+	context          int // unchanged lines around changes, -1 for the full listing
+}
+
+var defaultDiffParams = diffParams{algorithm: algorithmMyers, context: -1}
+
+func (p *BufferDiffPlugin) diffParamsFromOptions() (diffParams, error) {
+	params := diffParams{
+		algorithm:        p.stringOption("diff-algorithm", defaultDiffParams.algorithm),
+		ignoreWhitespace: p.boolOption("diff-ignore-whitespace", defaultDiffParams.ignoreWhitespace),
+		context:          p.intOption("diff-context", defaultDiffParams.context),
+	}
+	if params.algorithm != algorithmMyers && params.algorithm != algorithmPatience {
+		return diffParams{}, fmt.Errorf("unknown diff algorithm: %s", params.algorithm)
+	}
+	return params, nil
+}
+
+// match aligns the lines of a and b according to params.
+func (d diffParams) match(a, b []string) []int {
+	if d.ignoreWhitespace {
+		a, b = withoutWhitespace(a), withoutWhitespace(b)
+	}
+	if d.algorithm == algorithmPatience {
+		return matchLinesPatience(a, b)
+	}
+	return matchLinesMyers(a, b)
+}
+
+func withoutWhitespace(lines []string) []string {
+	keys := make([]string, len(lines))
+	for i, line := range lines {
+		keys[i] = strings.Join(strings.Fields(line), "")
+	}
+	return keys
+}
+
+// renderDiff returns the lines of a diff buffer comparing contentA with
+// contentB, and its changes as hunks without context whose body lines carry
+// their line in the diff buffer. With a negative context every line of both
+// sides is listed after the header; otherwise the changes are written as @@
+// hunks. Lines matched while ignoring whitespace are shown as in contentA.
+func renderDiff(nameA, contentA, nameB, contentB string, params diffParams) ([]string, []*patchHunk) {
+	a := strings.Split(contentA, "\n")
+	b := strings.Split(contentB, "\n")
+	listing := diffListing(a, b, params.match(a, b))
+
+	lines := []string{
+		fmt.Sprintf("--- %s", nameA),
+		fmt.Sprintf("+++ %s", nameB),
+	}
+	if params.context < 0 {
+		lines = append(lines, "")
+		for i, l := range listing {
+			listing[i].bufLine = len(lines)
+			lines = append(lines, string(l.op)+l.text)
+		}
+		return lines, groupHunks(listing, 0)
+	}
+
+	// Group a copy that remembers listing indexes, then record where each
+	// listing line is written.
+	indexed := make([]patchLine, len(listing))
+	for i, l := range listing {
+		indexed[i] = patchLine{op: l.op, text: l.text, bufLine: i}
+		listing[i].bufLine = -1
+	}
+	for _, hunk := range groupHunks(indexed, params.context) {
+		lines = append(lines, hunk.header())
+		for _, l := range hunk.lines {
+			listing[l.bufLine].bufLine = len(lines)
+			lines = append(lines, string(l.op)+l.text)
+		}
+	}
+	return lines, groupHunks(listing, 0)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderDiffWithContext(t *testing.T) {
+	lines, changes := renderDiff("a", "1\n2\n3\n4\n5\n6\n7\n8", "b", "1\ntwo\n3\n4\n5\n6\n7\neight", diffParams{algorithm: algorithmMyers, context: 1})
+	expected := "--- a\n+++ b\n@@ -1,3 +1,3 @@\n 1\n-2\n+two\n 3\n@@ -7,2 +7,2 @@\n 7\n-8\n+eight"
+	if got := strings.Join(lines, "\n"); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+	if len(changes) != 2 || changes[1].lines[0].bufLine != 9 {
+		t.Errorf("Expected the second change to start at diff line 9, got %+v", changes)
+	}
+}
+
+func TestRenderDiffIgnoreWhitespace(t *testing.T) {
+	params := diffParams{algorithm: algorithmMyers, ignoreWhitespace: true, context: -1}
+	lines, changes := renderDiff("a", "if x {\n\treturn\n}", "b", "if x  {\n    return\n}\nend", params)
+	expected := "--- a\n+++ b\n\n if x {\n \treturn\n }\n+end"
+	if got := strings.Join(lines, "\n"); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+	if len(changes) != 1 {
+		t.Errorf("Expected 1 change, got %d", len(changes))
+	}
+}
+
+func TestBufferDiffUnknownAlgorithm(t *testing.T) {
+	host := newMockHost(&mockBuffer{name: "a"}, &mockBuffer{name: "b"})
+	host.options["diff-algorithm"] = "histogram"
+	plugin := &BufferDiffPlugin{host: host}
+
+	err := plugin.ExecuteCommand("buffer-diff", "a", "b")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:unknown diff algorithm: histogram" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+}
+
+func TestDiffRefreshKeepsParamsAndCursor(t *testing.T) {
+	a := &mockBuffer{name: "a", content: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10"}
+	b := &mockBuffer{name: "b", content: "1\ntwo\n3\n4\n5\n6\n7\n8\n9\nten"}
+	host := newMockHost(a, b)
+	host.options["diff-context"] = 1
+	plugin := &BufferDiffPlugin{host: host}
+
+	plugin.ExecuteCommand("buffer-diff", "a", "b")
+	diff := host.buffers["*Diff: a <-> b*"]
+	diff.cursor = strings.Index(diff.content, "+ten")
+
+	// Options changed later do not affect the existing diff buffer.
+	host.options["diff-context"] = -1
+	b.content = "one\ntwo\n3\n4\n5\n6\n7\n8\n9\nten"
+
+	if err := plugin.ExecuteCommand("diff-refresh"); err == nil || err.Error() != "PLUGIN_MESSAGE:Diff refreshed: 2 differences" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if !strings.HasPrefix(diff.content, "--- a\n+++ b\n@@ -1,3 +1,3 @@\n-1\n-2\n+one\n+two\n 3\n@@") {
+		t.Errorf("Expected hunks with one line of context, got %q", diff.content)
+	}
+	if diff.cursor != strings.Index(diff.content, "+ten") {
+		t.Errorf("Expected cursor to stay on '+ten', got %d in %q", diff.cursor, diff.content)
+	}
+}
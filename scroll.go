@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	pluginsdk "github.com/TakahashiShuuhei/gmacs-plugin-sdk"
+)
+
+// diffSyncScrollMode keeps the windows of the two compared buffers scrolled
+// to corresponding lines, like ediff's scroll lock.
+const diffSyncScrollMode = "diff-sync-scroll-mode"
+
+// hookPostCommand is the host hook run after every command, when the
+// cursor or scroll position may have moved.
+const hookPostCommand = "post-command"
+
+// windowFinder is implemented by hosts that can return the window showing a
+// buffer, not only the current one. It is not part of the SDK's
+// HostInterface yet; RPCHostClient implements it over RPC.
+type windowFinder interface {
+	FindWindow(bufferName string) pluginsdk.WindowInterface
+}
+
+// scrollSync is a diff buffer in diff-sync-scroll-mode. The alignment is
+// kept with the contents it was computed from and recomputed when they
+// change; hooks cannot use the diff session, which commands update.
+type scrollSync struct {
+	sources            [2]string
+	params             diffParams
+	contentA, contentB string
+	changes            []*patchHunk
+}
+
+// alignment returns the changes between contentA and contentB.
+func (s *scrollSync) alignment(contentA, contentB string) []*patchHunk {
+	if s.changes == nil || contentA != s.contentA || contentB != s.contentB {
+		a := strings.Split(contentA, "\n")
+		b := strings.Split(contentB, "\n")
+		s.contentA, s.contentB = contentA, contentB
+		s.changes = groupHunks(diffListing(a, b, s.params.match(a, b)), 0)
+		if s.changes == nil {
+			s.changes = []*patchHunk{}
+		}
+	}
+	return s.changes
+}
+
+// alignedLine returns the line of the other side that line corresponds to,
+// given the changes from A to B. Inside a change it is the line at the same
+// offset into the other side's version, or its last line; a deletion maps to
+// the line after it.
+func alignedLine(changes []*patchHunk, line int, fromA bool) int {
+	delta := 0
+	for _, change := range changes {
+		from, fromCount, to, toCount := change.oldIndex(), change.oldCount, change.newIndex(), change.newCount
+		if !fromA {
+			from, fromCount, to, toCount = to, toCount, from, fromCount
+		}
+		if line < from {
+			break
+		}
+		if line < from+fromCount {
+			return to + min(line-from, max(toCount-1, 0))
+		}
+		delta = to + toCount - from - fromCount
+	}
+	return line + delta
+}
+
+// HandleDiffSyncScrollMode toggles synchronized scrolling of the buffers
+// compared in the current diff buffer.
+func (p *BufferDiffPlugin) HandleDiffSyncScrollMode() error {
+	if p.host == nil {
+		return fmt.Errorf("ERROR: host is nil")
+	}
+	buffer := p.host.GetCurrentBuffer()
+	if buffer == nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:No current buffer")
+	}
+	name := buffer.Name()
+
+	if p.stopSyncScroll(name) {
+		return fmt.Errorf("PLUGIN_MESSAGE:Stopped synchronized scrolling in %s", name)
+	}
+
+	s := p.sessions[name]
+	if s == nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:%s was not produced by buffer-diff", name)
+	}
+	if _, ok := p.host.(windowFinder); !ok {
+		return fmt.Errorf("PLUGIN_MESSAGE:The host cannot find the windows of %s and %s", s.bufferA, s.bufferB)
+	}
+	if !p.enableMinorMode(name, diffSyncScrollMode) {
+		return fmt.Errorf("PLUGIN_MESSAGE:Failed to enable %s", diffSyncScrollMode)
+	}
+
+	p.mu.Lock()
+	if p.scrollSyncs == nil {
+		p.scrollSyncs = map[string]*scrollSync{}
+	}
+	p.scrollSyncs[name] = &scrollSync{sources: [2]string{s.bufferA, s.bufferB}, params: s.params}
+	addHook := !p.scrollHooked
+	p.scrollHooked = true
+	p.mu.Unlock()
+	if addHook {
+		p.host.AddHook(hookPostCommand, p.syncScrollHook)
+	}
+	return fmt.Errorf("PLUGIN_MESSAGE:Synchronized scrolling of %s and %s", s.bufferA, s.bufferB)
+}
+
+// stopSyncScroll takes the diff buffer name out of diff-sync-scroll-mode
+// and reports whether it was in it.
+func (p *BufferDiffPlugin) stopSyncScroll(name string) bool {
+	p.mu.Lock()
+	enabled := p.scrollSyncs[name] != nil
+	delete(p.scrollSyncs, name)
+	p.mu.Unlock()
+	if enabled {
+		p.disableMinorMode(name, diffSyncScrollMode)
+	}
+	return enabled
+}
+
+// syncScrollHook scrolls the window of the other compared buffer when the
+// current window shows one side of a synchronized comparison. The line
+// corresponding to the cursor line is put on the same screen row.
+func (p *BufferDiffPlugin) syncScrollHook(args ...interface{}) error {
+	finder, ok := p.host.(windowFinder)
+	if !ok {
+		return nil
+	}
+	window := p.host.GetCurrentWindow()
+	if window == nil {
+		return nil
+	}
+	buffer := window.Buffer()
+	if buffer == nil {
+		return nil
+	}
+	name := buffer.Name()
+
+	p.mu.Lock()
+	var synced *scrollSync
+	for _, s := range p.scrollSyncs {
+		if s.sources[0] == name || s.sources[1] == name {
+			synced = s
+			break
+		}
+	}
+	p.mu.Unlock()
+	if synced == nil {
+		return nil
+	}
+
+	fromA := synced.sources[0] == name
+	otherName := synced.sources[1]
+	if !fromA {
+		otherName = synced.sources[0]
+	}
+	other := p.host.FindBuffer(otherName)
+	otherWindow := finder.FindWindow(otherName)
+	if other == nil || otherWindow == nil {
+		return nil
+	}
+
+	contentA, contentB := buffer.Content(), other.Content()
+	if !fromA {
+		contentA, contentB = contentB, contentA
+	}
+	p.mu.Lock()
+	changes := synced.alignment(contentA, contentB)
+	p.mu.Unlock()
+
+	line := lineAt(buffer.Content(), buffer.CursorPosition())
+	row := line - window.ScrollOffset()
+	top := max(alignedLine(changes, line, fromA)-row, 0)
+	if top != otherWindow.ScrollOffset() {
+		otherWindow.SetScrollOffset(top)
+	}
+	return nil
+}
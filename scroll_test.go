@@ -0,0 +1,112 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAlignedLine(t *testing.T) {
+	// b becomes X and Y; d is deleted.
+	changes := changeHunks("a\nb\nc\nd\ne", "a\nX\nY\nc\ne")
+
+	fromA := []int{0, 1, 3, 4, 4}
+	for line, expected := range fromA {
+		if result := alignedLine(changes, line, true); result != expected {
+			t.Errorf("Expected line %d of A to align with %d, got %d", line, expected, result)
+		}
+	}
+	fromB := []int{0, 1, 1, 2, 4}
+	for line, expected := range fromB {
+		if result := alignedLine(changes, line, false); result != expected {
+			t.Errorf("Expected line %d of B to align with %d, got %d", line, expected, result)
+		}
+	}
+}
+
+func TestDiffSyncScroll(t *testing.T) {
+	lines := numberedLines(100)
+	a := &mockBuffer{name: "a", content: strings.Join(lines, "\n")}
+	b := &mockBuffer{name: "b", content: strings.Join(append(numberedLines(10), lines...), "\n")}
+	host := newMockHost(a, b)
+	windowA := &mockWindow{buffer: a, height: 20}
+	windowB := &mockWindow{buffer: b, height: 20}
+	host.windows = []*mockWindow{windowA, windowB}
+	plugin := &BufferDiffPlugin{host: host}
+
+	plugin.ExecuteCommand("buffer-diff", "a", "b")
+	err := plugin.ExecuteCommand("diff-sync-scroll-mode")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:Synchronized scrolling of a and b" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if !host.minorModes["*Diff: a <-> b* "+diffSyncScrollMode] {
+		t.Errorf("Expected %s to be on", diffSyncScrollMode)
+	}
+
+	// Line 50 of a, ten rows down its window, is line 60 of b.
+	host.current = "a"
+	a.cursor = lineOffset(a.content, 50)
+	windowA.scroll = 40
+	host.TriggerHook(hookPostCommand)
+	if windowB.scroll != 50 {
+		t.Errorf("Expected the window of b to scroll to 50, got %d", windowB.scroll)
+	}
+
+	host.current = "b"
+	b.cursor = lineOffset(b.content, 65)
+	windowB.scroll = 60
+	host.TriggerHook(hookPostCommand)
+	if windowA.scroll != 50 {
+		t.Errorf("Expected the window of a to scroll to 50, got %d", windowA.scroll)
+	}
+
+	// Edits change the alignment.
+	b.content = strings.Join(append(numberedLines(20), lines...), "\n")
+	host.TriggerHook(hookPostCommand)
+	if windowA.scroll != 40 {
+		t.Errorf("Expected the window of a to follow the edit to 40, got %d", windowA.scroll)
+	}
+
+	host.current = "*Diff: a <-> b*"
+	err = plugin.ExecuteCommand("diff-sync-scroll-mode")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:Stopped synchronized scrolling in *Diff: a <-> b*" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if host.minorModes["*Diff: a <-> b* "+diffSyncScrollMode] {
+		t.Errorf("Expected %s to be off", diffSyncScrollMode)
+	}
+	host.current = "a"
+	host.TriggerHook(hookPostCommand)
+	if windowB.scroll != 60 {
+		t.Errorf("Expected the window of b to stay at 60, got %d", windowB.scroll)
+	}
+}
+
+func TestDiffSyncScrollStopsWithSession(t *testing.T) {
+	a := &mockBuffer{name: "a", content: "one\ntwo"}
+	b := &mockBuffer{name: "b", content: "one\nTWO"}
+	host := newMockHost(a, b)
+	host.windows = []*mockWindow{{buffer: a, height: 20}, {buffer: b, height: 20}}
+	plugin := &BufferDiffPlugin{host: host}
+	diffName := "*Diff: a <-> b*"
+
+	// Comparing again rebuilds the session and stops the scrolling.
+	plugin.ExecuteCommand("buffer-diff", "a", "b")
+	plugin.ExecuteCommand("diff-sync-scroll-mode")
+	plugin.ExecuteCommand("buffer-diff", "a", "b")
+	if plugin.scrollSyncs[diffName] != nil {
+		t.Errorf("Expected the rebuilt session to stop synchronized scrolling")
+	}
+	if host.minorModes[diffName+" "+diffSyncScrollMode] {
+		t.Errorf("Expected %s to be off", diffSyncScrollMode)
+	}
+
+	// Killing the diff buffer forgets it too.
+	err := plugin.ExecuteCommand("diff-sync-scroll-mode")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:Synchronized scrolling of a and b" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	host.killBuffer(diffName)
+	if len(plugin.scrollSyncs) != 0 {
+		t.Errorf("Expected no synchronized scrolling after the kill, got %v", plugin.scrollSyncs)
+	}
+}
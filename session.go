@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	pluginsdk "github.com/TakahashiShuuhei/gmacs-plugin-sdk"
+)
+
+// diffSessionMode is the minor mode that binds the ediff-style session keys
+// in a diff buffer.
+const diffSessionMode = "diff-session-mode"
+
+// diffSession is an ediff-style walk over the differences between two
+// buffers, started by buffer-diff.
+type diffSession struct {
+	bufferA, bufferB string
+	// The contents the differences were computed from, to notice edits.
+	contentA, contentB string
+	// One hunk per difference, without context. Body lines carry their
+	// line in the diff buffer.
+	hunks []*patchHunk
+	// The settings the diff buffer was produced with.
+	params diffParams
+	// Index of the current difference. When between is set there is no
+	// current difference and the position lies after difference current:
+	// before the first step, and after copying a difference away.
+	current int
+	between bool
+}
+
+// newDiffSession returns a session over the changes renderDiff found.
+func newDiffSession(nameA, contentA, nameB, contentB string, changes []*patchHunk, params diffParams) *diffSession {
+	return &diffSession{
+		bufferA:  nameA,
+		bufferB:  nameB,
+		contentA: contentA,
+		contentB: contentB,
+		hunks:    changes,
+		params:   params,
+		current:  -1,
+		between:  true,
+	}
+}
+
+// startDiffSession records s for diffBufferName and turns on the session
+// keys there.
+func (p *BufferDiffPlugin) startDiffSession(diffBufferName string, s *diffSession) {
+	if p.sessions == nil {
+		p.sessions = map[string]*diffSession{}
+	}
+	p.sessions[diffBufferName] = s
+	p.enableMinorMode(diffBufferName, diffSessionMode)
+}
+
+// currentSession returns the session of the current buffer and its two
+// source buffers. When either source changed since the differences were
+// computed, the diff buffer and the session are recomputed first.
+func (p *BufferDiffPlugin) currentSession() (diffBuffer, a, b pluginsdk.BufferInterface, s *diffSession, err error) {
+	diffBuffer = p.host.GetCurrentBuffer()
+	if diffBuffer == nil {
+		return nil, nil, nil, nil, fmt.Errorf("PLUGIN_MESSAGE:No current buffer")
+	}
+	s = p.sessions[diffBuffer.Name()]
+	if s == nil {
+		return nil, nil, nil, nil, fmt.Errorf("PLUGIN_MESSAGE:No diff session in %s", diffBuffer.Name())
+	}
+	if a = p.host.FindBuffer(s.bufferA); a == nil {
+		return nil, nil, nil, nil, fmt.Errorf("PLUGIN_MESSAGE:Buffer not found: %s", s.bufferA)
+	}
+	if b = p.host.FindBuffer(s.bufferB); b == nil {
+		return nil, nil, nil, nil, fmt.Errorf("PLUGIN_MESSAGE:Buffer not found: %s", s.bufferB)
+	}
+	if a.Content() != s.contentA || b.Content() != s.contentB {
+		s = p.recomputeSession(diffBuffer, a, b, s)
+	}
+	return diffBuffer, a, b, s, nil
+}
+
+// recomputeSession rewrites diffBuffer from the current contents of a and b
+// with the session's parameters and replaces its session. The current index
+// is kept where it still exists; otherwise the position moves past the last
+// difference.
+func (p *BufferDiffPlugin) recomputeSession(diffBuffer, a, b pluginsdk.BufferInterface, old *diffSession) *diffSession {
+	diff, changes := renderDiff(old.bufferA, a.Content(), old.bufferB, b.Content(), old.params)
+	diffBuffer.SetContent(strings.Join(diff, "\n"))
+	p.publishRefinedWords(diffBuffer.Name(), diffBuffer.Content())
+
+	s := newDiffSession(old.bufferA, a.Content(), old.bufferB, b.Content(), changes, old.params)
+	s.current = min(old.current, len(s.hunks)-1)
+	s.between = old.between || old.current >= len(s.hunks)
+	p.sessions[diffBuffer.Name()] = s
+	p.clearHunkFolds(diffBuffer.Name())
+	p.publishFolds(diffBuffer.Name(), diffBuffer.Content())
+	return s
+}
+
+// dropChanges forgets the differences within diff buffer lines first to
+// last, which were replaced by lines moving the rest by delta. A dropped
+// current difference leaves the position between differences, as copying
+// it away does.
+func (s *diffSession) dropChanges(first, last, delta int) {
+	var kept []*patchHunk
+	current, between := s.current, s.between
+	for i, hunk := range s.hunks {
+		hunkFirst, hunkLast := hunkSpan(hunk)
+		switch {
+		case hunkLast >= first && hunkFirst <= last:
+			if i <= s.current {
+				current--
+			}
+			if i == s.current {
+				between = true
+			}
+			continue
+		case hunkFirst > last:
+			for j := range hunk.lines {
+				hunk.lines[j].bufLine += delta
+			}
+		}
+		kept = append(kept, hunk)
+	}
+	s.hunks, s.current, s.between = kept, current, between
+}
+
+// HandleDiffSessionNext moves to the next difference.
+func (p *BufferDiffPlugin) HandleDiffSessionNext() error {
+	return p.stepDiffSession(1)
+}
+
+// HandleDiffSessionPrev moves to the previous difference.
+func (p *BufferDiffPlugin) HandleDiffSessionPrev() error {
+	return p.stepDiffSession(-1)
+}
+
+func (p *BufferDiffPlugin) stepDiffSession(step int) error {
+	if p.host == nil {
+		return fmt.Errorf("ERROR: host is nil")
+	}
+	diffBuffer, a, b, s, err := p.currentSession()
+	if err != nil {
+		return err
+	}
+	if len(s.hunks) == 0 {
+		return fmt.Errorf("PLUGIN_MESSAGE:No differences")
+	}
+
+	next := s.current + step
+	if s.between && step < 0 {
+		next = s.current
+	}
+	if next < 0 {
+		return fmt.Errorf("PLUGIN_MESSAGE:No previous difference")
+	}
+	if next >= len(s.hunks) {
+		return fmt.Errorf("PLUGIN_MESSAGE:No next difference")
+	}
+	s.current, s.between = next, false
+
+	// Show the difference in the diff buffer and at the corresponding
+	// lines of both sources.
+	hunk := s.hunks[s.current]
+	diffBuffer.SetCursorPosition(lineOffset(diffBuffer.Content(), hunk.lines[0].bufLine))
+	a.SetCursorPosition(lineOffset(a.Content(), hunk.oldIndex()))
+	b.SetCursorPosition(lineOffset(b.Content(), hunk.newIndex()))
+
+	return fmt.Errorf("PLUGIN_MESSAGE:Difference %d of %d", s.current+1, len(s.hunks))
+}
+
+// HandleDiffSessionCopyAToB replaces the current difference in B with A's
+// version.
+func (p *BufferDiffPlugin) HandleDiffSessionCopyAToB() error {
+	return p.copyDifference(true)
+}
+
+// HandleDiffSessionCopyBToA replaces the current difference in A with B's
+// version.
+func (p *BufferDiffPlugin) HandleDiffSessionCopyBToA() error {
+	return p.copyDifference(false)
+}
+
+func (p *BufferDiffPlugin) copyDifference(fromA bool) error {
+	if p.host == nil {
+		return fmt.Errorf("ERROR: host is nil")
+	}
+	diffBuffer, a, b, s, err := p.currentSession()
+	if err != nil {
+		return err
+	}
+	if s.between {
+		return fmt.Errorf("PLUGIN_MESSAGE:No current difference; use n or p to select one")
+	}
+
+	index := s.current
+	hunk := s.hunks[index]
+	from, to := s.bufferA, s.bufferB
+	if fromA {
+		replaceLines(b, strings.Split(b.Content(), "\n"), hunk.newIndex(), hunk.newCount, hunk.oldLines())
+	} else {
+		from, to = to, from
+		replaceLines(a, strings.Split(a.Content(), "\n"), hunk.oldIndex(), hunk.oldCount, hunk.newLines())
+	}
+
+	// The copied difference is gone; stepping continues from its place.
+	s = p.recomputeSession(diffBuffer, a, b, s)
+	s.current, s.between = index-1, true
+
+	return fmt.Errorf("PLUGIN_MESSAGE:Copied difference %d from %s to %s, %d remaining", index+1, from, to, len(s.hunks))
+}
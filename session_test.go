@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffSession(t *testing.T) {
+	a := &mockBuffer{name: "a", content: "one\ntwo\nthree\nfour\nfive\nsix"}
+	b := &mockBuffer{name: "b", content: "zero\none\ntwo\nthree\nFOUR\nfive\nsix"}
+	host := newMockHost(a, b)
+	plugin := &BufferDiffPlugin{host: host}
+
+	plugin.ExecuteCommand("buffer-diff", "a", "b")
+	diff := host.buffers["*Diff: a <-> b*"]
+
+	if err := plugin.ExecuteCommand("diff-session-copy-a-to-b"); err == nil || err.Error() != "PLUGIN_MESSAGE:No current difference; use n or p to select one" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if err := plugin.ExecuteCommand("diff-session-prev"); err == nil || err.Error() != "PLUGIN_MESSAGE:No previous difference" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if err := plugin.ExecuteCommand("diff-session-next"); err == nil || err.Error() != "PLUGIN_MESSAGE:Difference 1 of 2" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if err := plugin.ExecuteCommand("diff-session-next"); err == nil || err.Error() != "PLUGIN_MESSAGE:Difference 2 of 2" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+
+	// "four" is line 4 of a and "FOUR" line 5 of b.
+	if a.cursor != strings.Index(a.content, "four") {
+		t.Errorf("Expected cursor of a on 'four', got %d", a.cursor)
+	}
+	if b.cursor != strings.Index(b.content, "FOUR") {
+		t.Errorf("Expected cursor of b on 'FOUR', got %d", b.cursor)
+	}
+	if diff.cursor != strings.Index(diff.content, "-four") {
+		t.Errorf("Expected cursor of the diff buffer on '-four', got %d", diff.cursor)
+	}
+
+	err := plugin.ExecuteCommand("diff-session-copy-a-to-b")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:Copied difference 2 from a to b, 1 remaining" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if b.content != "zero\none\ntwo\nthree\nfour\nfive\nsix" {
+		t.Errorf("Unexpected content of b: %q", b.content)
+	}
+	if strings.Contains(diff.content, "FOUR") {
+		t.Errorf("Expected the diff buffer to be recomputed, got %q", diff.content)
+	}
+
+	if err := plugin.ExecuteCommand("diff-session-prev"); err == nil || err.Error() != "PLUGIN_MESSAGE:Difference 1 of 1" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	err = plugin.ExecuteCommand("diff-session-copy-b-to-a")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:Copied difference 1 from b to a, 0 remaining" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if a.content != b.content {
+		t.Errorf("Expected a to match b, got %q and %q", a.content, b.content)
+	}
+}
+
+func TestDiffSessionNoticesEdits(t *testing.T) {
+	a := &mockBuffer{name: "a", content: "one\ntwo\nthree\nfour"}
+	b := &mockBuffer{name: "b", content: "one\n2\nthree\nfour"}
+	host := newMockHost(a, b)
+	plugin := &BufferDiffPlugin{host: host}
+
+	plugin.ExecuteCommand("buffer-diff", "a", "b")
+	a.content = "one\ntwo\nthree\n4"
+
+	if err := plugin.ExecuteCommand("diff-session-next"); err == nil || err.Error() != "PLUGIN_MESSAGE:Difference 1 of 2" {
+		t.Errorf("Expected the session to be recomputed, got %v", err)
+	}
+
+	host.current = "a"
+	if err := plugin.ExecuteCommand("diff-session-next"); err == nil || err.Error() != "PLUGIN_MESSAGE:No diff session in a" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// diffWatchMode regenerates a diff buffer shortly after either compared
+// buffer is edited or saved.
+const diffWatchMode = "diff-watch-mode"
+
+// diffWatch is a diff buffer in diff-watch-mode: the buffers it compares,
+// and the refresh waiting for edits to settle.
+type diffWatch struct {
+	sources [2]string
+	timer   *time.Timer
+}
+
+// watchDelay is how long a watched diff waits after the last edit before it
+// refreshes.
+func (p *BufferDiffPlugin) watchDelay() time.Duration {
+	return time.Duration(p.intOption("diff-watch-delay", 500)) * time.Millisecond
+}
+
+// HandleDiffWatchMode toggles automatic refreshing of the current diff
+// buffer.
+func (p *BufferDiffPlugin) HandleDiffWatchMode() error {
+	if p.host == nil {
+		return fmt.Errorf("ERROR: host is nil")
+	}
+	buffer := p.host.GetCurrentBuffer()
+	if buffer == nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:No current buffer")
+	}
+	name := buffer.Name()
+
+	if p.unwatchDiff(name) {
+		p.disableMinorMode(name, diffWatchMode)
+		return fmt.Errorf("PLUGIN_MESSAGE:Stopped watching %s", name)
+	}
+	if err := p.watchDiff(name); err != nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:%v", err)
+	}
+	s := p.sessions[name]
+	return fmt.Errorf("PLUGIN_MESSAGE:Watching %s and %s", s.bufferA, s.bufferB)
+}
+
+// watchDiff puts diffBufferName in diff-watch-mode. When it already is, the
+// watch follows the buffers its session now compares.
+func (p *BufferDiffPlugin) watchDiff(diffBufferName string) error {
+	s := p.sessions[diffBufferName]
+	if s == nil {
+		return fmt.Errorf("%s was not produced by buffer-diff", diffBufferName)
+	}
+	sources := [2]string{s.bufferA, s.bufferB}
+
+	p.mu.Lock()
+	if w := p.watches[diffBufferName]; w != nil {
+		w.sources = sources
+		p.mu.Unlock()
+		return nil
+	}
+	p.mu.Unlock()
+	if !p.enableMinorMode(diffBufferName, diffWatchMode) {
+		return fmt.Errorf("Failed to enable %s", diffWatchMode)
+	}
+
+	p.mu.Lock()
+	if p.watches == nil {
+		p.watches = map[string]*diffWatch{}
+	}
+	p.watches[diffBufferName] = &diffWatch{sources: sources}
+	addHooks := !p.watchHooked
+	p.watchHooked = true
+	p.mu.Unlock()
+	if addHooks {
+		p.host.AddHook(hookAfterChange, p.watchHook)
+		p.host.AddHook(hookAfterSave, p.watchHook)
+	}
+	return nil
+}
+
+// unwatchDiff takes diffBufferName out of diff-watch-mode and drops any
+// pending refresh. It reports whether the buffer was watched.
+func (p *BufferDiffPlugin) unwatchDiff(diffBufferName string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	w := p.watches[diffBufferName]
+	if w == nil {
+		return false
+	}
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	delete(p.watches, diffBufferName)
+	return true
+}
+
+// watchHook schedules a refresh of every watched diff that compares the
+// buffer a change or save hook fired for. Each new edit restarts the wait,
+// so a burst of edits causes a single refresh.
+func (p *BufferDiffPlugin) watchHook(args ...interface{}) error {
+	buffer := p.hookBuffer(args)
+	if buffer == nil {
+		return nil
+	}
+	name := buffer.Name()
+	delay := p.watchDelay()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for diffBufferName, w := range p.watches {
+		if w.sources[0] != name && w.sources[1] != name {
+			continue
+		}
+		if w.timer != nil {
+			w.timer.Stop()
+		}
+		diffBufferName := diffBufferName
+		w.timer = time.AfterFunc(delay, func() { p.refreshWatched(diffBufferName) })
+	}
+	return nil
+}
+
+// refreshWatched runs the refresh scheduled by watchHook. It waits for any
+// running command, since both change the diff buffer and its session.
+func (p *BufferDiffPlugin) refreshWatched(diffBufferName string) {
+	p.mu.Lock()
+	w := p.watches[diffBufferName]
+	if w != nil {
+		w.timer = nil
+	}
+	p.mu.Unlock()
+	if w == nil {
+		return
+	}
+
+	p.execMu.Lock()
+	defer p.execMu.Unlock()
+	buffer := p.host.FindBuffer(diffBufferName)
+	if buffer == nil {
+		p.unwatchDiff(diffBufferName)
+		return
+	}
+	if _, err := p.refreshDiff(buffer); err != nil {
+		fmt.Printf("[PLUGIN] refreshWatched: '%s': %v\n", diffBufferName, err)
+	}
+}
+
+// watchedDiff reports whether diffBufferName is in diff-watch-mode.
+func (p *BufferDiffPlugin) watchedDiff(diffBufferName string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.watches[diffBufferName] != nil
+}
+
+// stopWatching drops every pending refresh.
+func (p *BufferDiffPlugin) stopWatching() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, w := range p.watches {
+		if w.timer != nil {
+			w.timer.Stop()
+			w.timer = nil
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffWatchMode(t *testing.T) {
+	a := &mockBuffer{name: "a", content: "one\ntwo\nthree"}
+	b := &mockBuffer{name: "b", content: "one\ntwo\nthree"}
+	host := newMockHost(a, b)
+	host.options["diff-watch-delay"] = 50
+	plugin := &BufferDiffPlugin{host: host}
+
+	plugin.ExecuteCommand("buffer-diff", "a", "b")
+	diff := host.buffers["*Diff: a <-> b*"]
+
+	err := plugin.ExecuteCommand("diff-watch-mode")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:Watching a and b" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	if !host.minorModes[diff.name+" "+diffWatchMode] {
+		t.Errorf("Expected %s to be on", diffWatchMode)
+	}
+
+	// A burst of edits refreshes once, after the last one settles.
+	b.content = "one\nTWO\nthree"
+	host.TriggerHook(hookAfterChange, "b")
+	time.Sleep(20 * time.Millisecond)
+	host.TriggerHook(hookAfterChange, "b")
+	time.Sleep(20 * time.Millisecond)
+
+	plugin.execMu.Lock()
+	if strings.Contains(diff.content, "TWO") {
+		t.Errorf("Expected the refresh to wait for edits to settle, got %q", diff.content)
+	}
+	plugin.execMu.Unlock()
+
+	time.Sleep(150 * time.Millisecond)
+	plugin.execMu.Lock()
+	if !strings.Contains(diff.content, "+TWO") {
+		t.Errorf("Expected the diff buffer to be refreshed, got %q", diff.content)
+	}
+	plugin.execMu.Unlock()
+
+	// Edits to unrelated buffers and after watching stops are ignored.
+	err = plugin.ExecuteCommand("diff-watch-mode")
+	if host.minorModes[diff.name+" "+diffWatchMode] {
+		t.Errorf("Expected %s to be off", diffWatchMode)
+	}
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:Stopped watching *Diff: a <-> b*" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	a.content = "ONE\ntwo\nthree"
+	host.TriggerHook(hookAfterSave, "a")
+	time.Sleep(100 * time.Millisecond)
+	plugin.execMu.Lock()
+	if strings.Contains(diff.content, "ONE") {
+		t.Errorf("Expected no refresh after watching stopped, got %q", diff.content)
+	}
+	plugin.execMu.Unlock()
+}
+
+func TestDiffWatchModeRequiresSession(t *testing.T) {
+	buffer := &mockBuffer{name: "notes"}
+	plugin := &BufferDiffPlugin{host: newMockHost(buffer)}
+
+	err := plugin.ExecuteCommand("diff-watch-mode")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:notes was not produced by buffer-diff" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+}
+
+func TestDiffAutoRefresh(t *testing.T) {
+	a := &mockBuffer{name: "a", content: "one"}
+	b := &mockBuffer{name: "b", content: "one"}
+	host := newMockHost(a, b)
+	host.options["diff-auto-refresh"] = true
+	plugin := &BufferDiffPlugin{host: host}
+
+	plugin.ExecuteCommand("buffer-diff", "a", "b")
+	if !plugin.watchedDiff("*Diff: a <-> b*") {
+		t.Errorf("Expected buffer-diff to enable %s", diffWatchMode)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+
+	pluginsdk "github.com/TakahashiShuuhei/gmacs-plugin-sdk"
+)
+
+// snapshotBufferName names the buffer holding the file of bufferName as it
+// is on disk.
+func snapshotBufferName(bufferName string) string {
+	return fmt.Sprintf("*On disk: %s*", bufferName)
+}
+
+// loadSnapshot reads the file buffer visits into its snapshot buffer and
+// returns the snapshot's name.
+func (p *BufferDiffPlugin) loadSnapshot(buffer pluginsdk.BufferInterface) (string, error) {
+	content, err := savedContent(buffer)
+	if err != nil {
+		return "", err
+	}
+	name := snapshotBufferName(buffer.Name())
+	snapshot := p.host.FindBuffer(name)
+	if snapshot == nil {
+		snapshot = p.host.CreateBuffer(name)
+		if snapshot == nil {
+			return "", fmt.Errorf("Failed to create %s", name)
+		}
+	}
+	if snapshot.Content() != content {
+		snapshot.SetContent(content)
+	}
+	if p.snapshots == nil {
+		p.snapshots = map[string]string{}
+	}
+	p.snapshots[name] = buffer.Filename()
+	return name, nil
+}
+
+// reloadSnapshot reads the file again when bufferName is a snapshot made by
+// buffer-diff-with-file, so refreshing compares with what is on disk now.
+func (p *BufferDiffPlugin) reloadSnapshot(bufferName string) error {
+	path, ok := p.snapshots[bufferName]
+	if !ok {
+		return nil
+	}
+	snapshot := p.host.FindBuffer(bufferName)
+	if snapshot == nil {
+		return fmt.Errorf("Buffer not found: %s", bufferName)
+	}
+	content, err := fileContent(path)
+	if err != nil {
+		return fmt.Errorf("Cannot read %s: %v", path, err)
+	}
+	if snapshot.Content() != content {
+		snapshot.SetContent(content)
+	}
+	return nil
+}
+
+// HandleBufferDiffWithFile compares the current buffer with its file as it
+// is on disk, like Emacs diff-buffer-with-file. The file is read into a
+// *On disk* buffer, shown as the old side, so the diff buffer works as any
+// other: diff-session-copy-a-to-b restores the saved version of a
+// difference, and diff-refresh reads the file again.
+func (p *BufferDiffPlugin) HandleBufferDiffWithFile() error {
+	if p.host == nil {
+		return fmt.Errorf("ERROR: host is nil")
+	}
+	buffer := p.host.GetCurrentBuffer()
+	if buffer == nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:No current buffer")
+	}
+
+	snapshot, err := p.loadSnapshot(buffer)
+	if err != nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:Cannot compare with file: %v", err)
+	}
+	params, err := p.diffParamsFromOptions()
+	if err != nil {
+		return fmt.Errorf("PLUGIN_MESSAGE:%v", err)
+	}
+	return p.compareBuffers(snapshot, buffer.Name(), params)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBufferDiffWithFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.txt")
+	os.WriteFile(path, []byte("one\ntwo\nthree"), 0644)
+	buffer := &mockBuffer{name: "main.txt", content: "one\nTWO\nthree", filename: path, dirty: true}
+	host := newMockHost(buffer)
+	host.options["diff-history-size"] = 50
+	host.options["diff-history-file"] = filepath.Join(dir, "history.json")
+	plugin := &BufferDiffPlugin{host: host}
+
+	err := plugin.ExecuteCommand("buffer-diff-with-file")
+	expected := "PLUGIN_MESSAGE:Buffer diff completed: 1 differences found, first at line 2 of *On disk: main.txt* and line 2 of main.txt"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Unexpected result: %v", err)
+	}
+	diff := host.buffers["*Diff: *On disk: main.txt* <-> main.txt*"]
+	if diff == nil || !strings.Contains(diff.content, "\n-two\n+TWO\n") {
+		t.Fatalf("Expected the saved and unsaved lines in the diff, got %v", diff)
+	}
+	if len(plugin.history) != 0 {
+		t.Errorf("Expected comparisons with a file to stay out of the history, got %d entries", len(plugin.history))
+	}
+
+	// After saving, a refresh reads the file again.
+	os.WriteFile(path, []byte(buffer.content), 0644)
+	err = plugin.ExecuteCommand("diff-refresh")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:Diff refreshed: 0 differences" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+}
+
+func TestBufferDiffWithFileErrors(t *testing.T) {
+	host := newMockHost(&mockBuffer{name: "scratch", content: "text"})
+	plugin := &BufferDiffPlugin{host: host}
+
+	err := plugin.ExecuteCommand("buffer-diff-with-file")
+	if err == nil || err.Error() != "PLUGIN_MESSAGE:Cannot compare with file: scratch is not visiting a file" {
+		t.Errorf("Unexpected result: %v", err)
+	}
+
+	// A file that was never saved compares as empty.
+	path := filepath.Join(t.TempDir(), "new.txt")
+	host = newMockHost(&mockBuffer{name: "new.txt", content: "fresh", filename: path})
+	plugin = &BufferDiffPlugin{host: host}
+	plugin.ExecuteCommand("buffer-diff-with-file")
+	diff := host.buffers["*Diff: *On disk: new.txt* <-> new.txt*"]
+	if diff == nil || !strings.Contains(diff.content, "+fresh") {
+		t.Errorf("Expected the whole buffer as added, got %v", diff)
+	}
+}